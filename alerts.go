@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// availabilitySetMatcherRegex finds the availability_set label matchers of an alert expression
+var availabilitySetMatcherRegex = regexp.MustCompile(`availability_set\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`[^`]*`" + `)`)
+
+// blueprintAlert is an alert of a blueprint telemetry.alerting block
+type blueprintAlert struct {
+	Name       string
+	Expression string
+	Data       map[interface{}]interface{}
+	// Index is the position of the alert in telemetry.alerting.alerts
+	Index int
+}
+
+// blueprintAlerts returns the telemetry.alerting.alerts entries of a blueprint
+func blueprintAlerts(yamlData map[string]interface{}) []blueprintAlert {
+	var alerts []blueprintAlert
+
+	telemetry, _ := yamlData["telemetry"].(map[interface{}]interface{})
+	alerting, _ := telemetry["alerting"].(map[interface{}]interface{})
+	alertList, _ := alerting["alerts"].([]interface{})
+	for i, alert := range alertList {
+		if alertMap, ok := alert.(map[interface{}]interface{}); ok {
+			name, _ := alertMap["alertname"].(string)
+			expression, _ := alertMap["expression"].(string)
+			alerts = append(alerts, blueprintAlert{Name: name, Expression: expression, Data: alertMap, Index: i})
+		}
+	}
+
+	return alerts
+}
+
+// constructAvailabilitySetName returns the availability set of a VM group, e.g. WE1-DEV-INFRASTRUCTURE-HAPROXY-WAF-INTEGRATIONS-WAF
+func constructAvailabilitySetName(envMap map[interface{}]interface{}, yamlData map[string]interface{}, vmName string) string {
+	return strings.ToUpper(fmt.Sprintf("%s-%s", constructResourceGroupName(envMap, yamlData), vmName))
+}
+
+// expectedAvailabilitySets returns the availability sets of every VM group of a blueprint in every dc-env
+func expectedAvailabilitySets(yamlData map[string]interface{}) []string {
+	var sets []string
+
+	for _, envMap := range environmentEntries(yamlData) {
+		if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
+			for _, vm := range vmList {
+				if vmMap, ok := vm.(map[interface{}]interface{}); ok {
+					if vmName, ok := vmMap["name"].(string); ok {
+						sets = append(sets, constructAvailabilitySetName(envMap, yamlData, vmName))
+					}
+				}
+			}
+		}
+	}
+
+	return sets
+}
+
+// availabilitySetMatcher is a positive availability_set label matcher of an alert expression
+type availabilitySetMatcher struct {
+	Operator string
+	Value    string
+}
+
+// availabilitySetMatchers extracts the availability_set = and =~ matchers of an alert expression
+func availabilitySetMatchers(expression string) []availabilitySetMatcher {
+	var matchers []availabilitySetMatcher
+
+	for _, match := range availabilitySetMatcherRegex.FindAllStringSubmatch(expression, -1) {
+		if match[1] != "=" && match[1] != "=~" {
+			continue
+		}
+
+		value := match[2]
+		if strings.HasPrefix(value, "'") {
+			// PromQL single quoted strings use the same escapes as double quoted ones
+			value = `"` + strings.ReplaceAll(strings.ReplaceAll(value[1:len(value)-1], `\'`, `'`), `"`, `\"`) + `"`
+		}
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			unquoted = value[1 : len(value)-1]
+		}
+
+		matchers = append(matchers, availabilitySetMatcher{Operator: match[1], Value: unquoted})
+	}
+
+	return matchers
+}
+
+// checkAvailabilitySetMatcher returns why a matcher cannot match any expected availability set, or an empty string if it can
+func checkAvailabilitySetMatcher(matcher availabilitySetMatcher, pbn string, expectedSets []string) string {
+	var matches func(string) bool
+	if matcher.Operator == "=" {
+		matches = func(set string) bool { return set == matcher.Value }
+	} else {
+		// Prometheus regex matchers are fully anchored
+		re, err := regexp.Compile("^(?:" + matcher.Value + ")$")
+		if err != nil {
+			return fmt.Sprintf("has an invalid availability_set regex %q: %v", matcher.Value, err)
+		}
+		matches = re.MatchString
+	}
+
+	for _, set := range expectedSets {
+		if matches(set) {
+			return ""
+		}
+	}
+
+	upperValue := strings.ToUpper(matcher.Value)
+	upperPBN := strings.ToUpper(pbn)
+	index := strings.Index(upperValue, upperPBN)
+	if index < 0 {
+		return fmt.Sprintf("uses availability_set %q which does not refer to blueprint %s", matcher.Value, pbn)
+	}
+
+	// The part after the blueprint name is the VM group
+	vmGroup := strings.TrimPrefix(upperValue[index+len(upperPBN):], "-")
+	vmGroupExists := false
+	for _, set := range expectedSets {
+		if strings.HasSuffix(set, "-"+vmGroup) {
+			vmGroupExists = true
+		}
+	}
+	if vmGroup != "" && regexp.QuoteMeta(vmGroup) == vmGroup && !vmGroupExists {
+		return fmt.Sprintf("uses availability_set %q which refers to VM group %s that does not exist", matcher.Value, strings.ToLower(vmGroup))
+	}
+
+	return fmt.Sprintf("uses availability_set %q which cannot match any VM", matcher.Value)
+}
+
+func checkBlueprintsAlerts(fileNames []string, config *Config) []Finding {
+	// Store cleanup guidance
+	var findings []Finding
+
+	for _, file := range targetFiles(loadYAMLFiles(fileNames), config) {
+		pbn := blueprintPBN(file.Data)
+		expectedSets := expectedAvailabilitySets(file.Data)
+
+		for _, alert := range blueprintAlerts(file.Data) {
+			for _, matcher := range availabilitySetMatchers(alert.Expression) {
+				if problem := checkAvailabilitySetMatcher(matcher, pbn, expectedSets); problem != "" {
+					slog.Info("Alert "+problem, "alert", alert.Name, "blueprint", pbn)
+					findings = append(findings, newFinding("blueprints-alerts", severityWarning, file.Data, file.FileName, fmt.Sprintf("Alert %s of blueprint %s %s. Check file %s", alert.Name, pbn, problem, file.FileName)).at("telemetry", "alerting", "alerts", alert.Index, "expression"))
+				} else {
+					slog.Debug("Alert matches its VMs", "alert", alert.Name, "blueprint", pbn)
+				}
+			}
+		}
+	}
+
+	return findings
+}
+
+// defaultAlertEnvironments are the environments accepted in alert notify blocks when alertEnvironments is not configured
+var defaultAlertEnvironments = []string{"dev", "qa", "prd"}
+
+// blueprintAlertContacts returns the contacts defined in the telemetry.alerting.contacts block of a blueprint
+func blueprintAlertContacts(yamlData map[string]interface{}) map[string]bool {
+	contacts := make(map[string]bool)
+
+	telemetry, _ := yamlData["telemetry"].(map[interface{}]interface{})
+	alerting, _ := telemetry["alerting"].(map[interface{}]interface{})
+	contactMap, _ := alerting["contacts"].(map[interface{}]interface{})
+	for contact := range contactMap {
+		contacts[fmt.Sprint(contact)] = true
+	}
+
+	return contacts
+}
+
+// checkAlertRule returns the problems of a blueprint alert: PromQL syntax, for duration, notify environments and routes
+func checkAlertRule(alert blueprintAlert, contacts map[string]bool, environments []string) []string {
+	var problems []string
+
+	if alert.Name == "" {
+		problems = append(problems, "has no alertname")
+	}
+
+	if alert.Expression == "" {
+		problems = append(problems, "has no expression")
+	} else if _, err := parser.ParseExpr(alert.Expression); err != nil {
+		problems = append(problems, fmt.Sprintf("has an invalid PromQL expression: %v", err))
+	}
+
+	if forValue, ok := alert.Data["for"]; ok {
+		forString, _ := forValue.(string)
+		if _, err := model.ParseDuration(forString); err != nil {
+			problems = append(problems, fmt.Sprintf("has an invalid for duration %v", forValue))
+		}
+	}
+
+	notifyList, ok := alert.Data["notify"].([]interface{})
+	if _, present := alert.Data["notify"]; present && !ok {
+		problems = append(problems, "has a notify block that is not a list")
+	}
+	for _, notify := range notifyList {
+		notifyMap, ok := notify.(map[interface{}]interface{})
+		if !ok {
+			problems = append(problems, "has a notify entry that is not a map")
+			continue
+		}
+
+		environment, _ := notifyMap["environment"].(string)
+		knownEnvironment := false
+		for _, known := range environments {
+			if strings.EqualFold(environment, known) {
+				knownEnvironment = true
+			}
+		}
+		if !knownEnvironment {
+			problems = append(problems, fmt.Sprintf("notifies unknown environment %v", notifyMap["environment"]))
+		}
+
+		routes, _ := notifyMap["routes"].([]interface{})
+		if len(routes) == 0 {
+			problems = append(problems, fmt.Sprintf("has no routes for environment %s", environment))
+		}
+		for _, route := range routes {
+			if !contacts[fmt.Sprint(route)] {
+				problems = append(problems, fmt.Sprintf("routes environment %s to %v which is not defined in alerting.contacts", environment, route))
+			}
+		}
+	}
+
+	return problems
+}
+
+func checkBlueprintsAlertRules(fileNames []string, config *Config) []Finding {
+	environments := config.Application.AlertEnvironments
+	if len(environments) == 0 {
+		environments = defaultAlertEnvironments
+	}
+
+	// Store cleanup guidance
+	var findings []Finding
+
+	for _, file := range targetFiles(loadYAMLFiles(fileNames), config) {
+		pbn := blueprintPBN(file.Data)
+		contacts := blueprintAlertContacts(file.Data)
+
+		for _, alert := range blueprintAlerts(file.Data) {
+			problems := checkAlertRule(alert, contacts, environments)
+			if len(problems) == 0 {
+				slog.Debug("Alert is valid", "alert", alert.Name, "blueprint", pbn)
+			}
+			for _, problem := range problems {
+				slog.Info("Alert "+problem, "alert", alert.Name, "blueprint", pbn)
+				findings = append(findings, newFinding("blueprints-alert-rules", severityError, file.Data, file.FileName, fmt.Sprintf("Alert %s of blueprint %s %s. Check file %s", alert.Name, pbn, problem, file.FileName)).at("telemetry", "alerting", "alerts", alert.Index))
+			}
+		}
+	}
+
+	return findings
+}
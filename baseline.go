@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// findingsRun is the JSON format of the findings of a run, used as the baseline of the next runs
+type findingsRun struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Dc          string    `json:"dc"`
+	Env         string    `json:"env"`
+	Findings    []Finding `json:"findings"`
+}
+
+// findingsDiff holds the findings added, resolved and unchanged since a baseline run
+type findingsDiff struct {
+	Added     []Finding
+	Resolved  []Finding
+	Unchanged []Finding
+}
+
+// newFindingsRun gathers the findings of the check results
+func newFindingsRun(results []checkResult, config *Config, now time.Time) findingsRun {
+	run := findingsRun{GeneratedAt: now, Dc: config.Application.Dc, Env: config.Application.Env, Findings: []Finding{}}
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			finding.Fingerprint = findingFingerprint(finding)
+			run.Findings = append(run.Findings, finding)
+		}
+	}
+	return run
+}
+
+// writeFindingsRun writes the findings of a run as JSON
+func writeFindingsRun(fileName string, run findingsRun) error {
+	content, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(content, '\n'), 0644)
+}
+
+// readFindingsRun reads the findings of a run written by writeFindingsRun
+func readFindingsRun(fileName string) (findingsRun, error) {
+	var run findingsRun
+
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return run, fmt.Errorf("error reading baseline: %v", err)
+	}
+	if err := json.Unmarshal(content, &run); err != nil {
+		return run, fmt.Errorf("error parsing baseline %s: %v", fileName, err)
+	}
+
+	return run, nil
+}
+
+// findingKey identifies a finding across runs by what it is about, the message is left out so rewording it or the times it contains don't change the key
+func findingKey(finding Finding) string {
+	return strings.Join([]string{finding.Check, finding.Blueprint, finding.Dc, finding.Env, finding.VM, finding.FileName, finding.Path}, "\x00")
+}
+
+// findingFingerprint is the SHA-256 fingerprint of the findingKey of a finding, shared with code scanning and issue trackers
+func findingFingerprint(finding Finding) string {
+	fingerprint := sha256.Sum256([]byte(findingKey(finding)))
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// diffFindings compares the findings of a run with the baseline ones, the same finding reported several times is matched as many times
+func diffFindings(baseline []Finding, current []Finding) findingsDiff {
+	var diff findingsDiff
+
+	remaining := make(map[string][]Finding)
+	for _, finding := range baseline {
+		key := findingKey(finding)
+		remaining[key] = append(remaining[key], finding)
+	}
+
+	for _, finding := range current {
+		key := findingKey(finding)
+		if len(remaining[key]) > 0 {
+			remaining[key] = remaining[key][1:]
+			diff.Unchanged = append(diff.Unchanged, finding)
+		} else {
+			diff.Added = append(diff.Added, finding)
+		}
+	}
+
+	// Keep the baseline order for the resolved findings
+	for _, finding := range baseline {
+		key := findingKey(finding)
+		if len(remaining[key]) > 0 {
+			remaining[key] = remaining[key][1:]
+			diff.Resolved = append(diff.Resolved, finding)
+		}
+	}
+
+	return diff
+}
+
+// printFindingsDiff writes the findings added and resolved since the baseline to the report, grouped by check
+func printFindingsDiff(w io.Writer, diff findingsDiff, baseline findingsRun, config *Config) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "\n\n#############################\n# Changes since %s %s-%s\n# %d added, %d resolved, %d unchanged\n#############################\n", baseline.GeneratedAt.Format(time.RFC3339), config.Application.Dc, config.Application.Env, len(diff.Added), len(diff.Resolved), len(diff.Unchanged))
+
+	for _, section := range []struct {
+		title    string
+		findings []Finding
+	}{
+		{"Added", diff.Added},
+		{"Resolved", diff.Resolved},
+	} {
+		if len(section.findings) == 0 {
+			continue
+		}
+
+		byCheck := make(map[string][]string)
+		var checkNames []string
+		for _, finding := range section.findings {
+			if _, ok := byCheck[finding.Check]; !ok {
+				checkNames = append(checkNames, finding.Check)
+			}
+			byCheck[finding.Check] = append(byCheck[finding.Check], finding.describe())
+		}
+		sort.Strings(checkNames)
+
+		fmt.Fprintf(&b, "\n# %s\n", section.title)
+		for _, checkName := range checkNames {
+			fmt.Fprintf(&b, "## %s\n", checkName)
+			for _, message := range byCheck[checkName] {
+				fmt.Fprintf(&b, "%s\n", message)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "\n#############################\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
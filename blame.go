@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitChange is the last commit that touched the file, or the lines, of a finding
+type gitChange struct {
+	Commit  string    `json:"commit"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// String describes the change for the cleanup suggestions, e.g. stale since 2022-04, last changed by X
+func (c gitChange) String() string {
+	return fmt.Sprintf("stale since %s, last changed by %s: %s", c.Date.Format("2006-01"), c.Author, c.Message)
+}
+
+// gitBlame caches the last changes of the files and line ranges of the findings
+type gitBlame struct {
+	changes map[string]*gitChange
+	// failed holds the files without git history, e.g. outside of a git repository
+	failed map[string]bool
+}
+
+func newGitBlame() *gitBlame {
+	return &gitBlame{changes: make(map[string]*gitChange), failed: make(map[string]bool)}
+}
+
+// commitHashRegex matches the SHA-1 and SHA-256 commit hashes of git blame
+var commitHashRegex = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+
+// environmentBlockLines returns the first and last lines of the environment_specific entry of a dc-env in a file, 0 when not found
+func environmentBlockLines(fileName string, dc string, env string) (int, int) {
+	_, node := yamlEnvironmentNode(fileName, dc, env)
+	if node == nil {
+		return 0, 0
+	}
+	return node.Line, yamlLastLine(node)
+}
+
+// fileChange returns the last commit that touched a file
+func (b *gitBlame) fileChange(fileName string) (*gitChange, error) {
+	if change, ok := b.changes[fileName]; ok {
+		return change, nil
+	}
+
+	output, err := runGit(filepath.Dir(fileName), "log", "-1", "--format=%H%x00%an%x00%aI%x00%s", "--", filepath.Base(fileName))
+	if err != nil {
+		return nil, err
+	}
+	var change *gitChange
+	if fields := strings.Split(strings.TrimSpace(output), "\x00"); len(fields) == 4 {
+		date, _ := time.Parse(time.RFC3339, fields[2])
+		change = &gitChange{Commit: fields[0], Author: fields[1], Date: date.UTC(), Message: fields[3]}
+	}
+	b.changes[fileName] = change
+
+	return change, nil
+}
+
+// linesChange returns the last commit that touched a range of lines of a file
+func (b *gitBlame) linesChange(fileName string, start int, end int) (*gitChange, error) {
+	key := fmt.Sprintf("%s:%d-%d", fileName, start, end)
+	if change, ok := b.changes[key]; ok {
+		return change, nil
+	}
+
+	output, err := runGit(filepath.Dir(fileName), "blame", "--porcelain", "-L", fmt.Sprintf("%d,%d", start, end), "--", filepath.Base(fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	// The porcelain format gives the commit headers once, keep the most recent commit
+	var change, latest *gitChange
+	var latestTime int64
+	var authorTime int64
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(line, " ", 2)
+		switch {
+		case commitHashRegex.MatchString(fields[0]) && !strings.HasPrefix(line, "\t"):
+			change = &gitChange{Commit: fields[0]}
+		case change == nil || len(fields) < 2:
+		case fields[0] == "author":
+			change.Author = fields[1]
+		case fields[0] == "author-time":
+			authorTime, _ = strconv.ParseInt(fields[1], 10, 64)
+			change.Date = time.Unix(authorTime, 0).UTC()
+		case fields[0] == "summary":
+			change.Message = fields[1]
+			// Uncommitted lines have no author date worth reporting
+			if strings.Trim(change.Commit, "0") != "" && (latest == nil || authorTime > latestTime) {
+				latest, latestTime = change, authorTime
+			}
+		}
+	}
+	b.changes[key] = latest
+
+	return latest, nil
+}
+
+// enrich sets the last change of the findings, from their dc-env block or their line when found, otherwise from their file
+func (b *gitBlame) enrich(findings []Finding) {
+	for i, finding := range findings {
+		if finding.FileName == "" || b.failed[finding.FileName] {
+			continue
+		}
+
+		var change *gitChange
+		var err error
+		if start, end := environmentBlockLines(finding.FileName, finding.Dc, finding.Env); start > 0 {
+			change, err = b.linesChange(finding.FileName, start, end)
+		} else if finding.Line > 0 {
+			change, err = b.linesChange(finding.FileName, finding.Line, finding.Line)
+		}
+		if change == nil && err == nil {
+			change, err = b.fileChange(finding.FileName)
+		}
+		if err != nil {
+			slog.Warn("Error reading git history", "file", finding.FileName, "error", err)
+			b.failed[finding.FileName] = true
+			continue
+		}
+		findings[i].LastChange = change
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// documentReport is the content of the Markdown and HTML reports
+type documentReport struct {
+	Title       string
+	GeneratedAt string
+	ByDcEnv     []documentSummaryRow
+	ByCheck     []documentSummaryRow
+	Checks      []documentCheck
+}
+
+// documentSummaryRow counts the findings of a dc-env or a check
+type documentSummaryRow struct {
+	Name       string
+	Errors     int
+	Warnings   int
+	Info       int
+	Suppressed int
+}
+
+type documentCheck struct {
+	Title      string
+	Scope      string
+	Blueprints []documentBlueprint
+}
+
+type documentBlueprint struct {
+	Name     string
+	Findings []documentFinding
+}
+
+type documentFinding struct {
+	Severity string
+	Message  string
+	Location string
+	Link     string
+}
+
+// add counts a finding in the summary row
+func (r *documentSummaryRow) add(finding Finding) {
+	switch finding.Severity {
+	case severityError:
+		r.Errors++
+	case severityWarning:
+		r.Warnings++
+	default:
+		r.Info++
+	}
+}
+
+// findingDcEnv returns the dc-env of a finding, the configured one for the findings about a whole file
+func findingDcEnv(finding Finding, config *Config) string {
+	if finding.Dc != "" || finding.Env != "" {
+		return finding.Dc + "-" + finding.Env
+	}
+	return config.Application.Dc + "-" + config.Application.Env
+}
+
+// newDocumentReport groups the findings for the Markdown and HTML reports, the file links are prefixed with linkBaseURL
+func newDocumentReport(results []checkResult, config *Config, linkBaseURL string) documentReport {
+	report := documentReport{
+		Title:       fmt.Sprintf("Cleanup suggestions %s-%s", config.Application.Dc, config.Application.Env),
+		GeneratedAt: time.Now().Format(time.RFC3339),
+	}
+	uris := &repositoryURIs{topLevels: make(map[string]string)}
+
+	dcEnvRows := make(map[string]*documentSummaryRow)
+	dcEnvRow := func(name string) *documentSummaryRow {
+		if _, ok := dcEnvRows[name]; !ok {
+			dcEnvRows[name] = &documentSummaryRow{Name: name}
+		}
+		return dcEnvRows[name]
+	}
+
+	for _, result := range results {
+		checkRow := documentSummaryRow{Name: result.Title, Suppressed: len(result.Suppressed)}
+		for _, finding := range result.Suppressed {
+			dcEnvRow(findingDcEnv(finding, config)).Suppressed++
+		}
+
+		section := documentCheck{Title: result.Title, Scope: result.Scope}
+		blueprintIndexes := make(map[string]int)
+		for _, finding := range result.Findings {
+			checkRow.add(finding)
+			dcEnvRow(findingDcEnv(finding, config)).add(finding)
+
+			index, ok := blueprintIndexes[finding.Blueprint]
+			if !ok {
+				index = len(section.Blueprints)
+				blueprintIndexes[finding.Blueprint] = index
+				section.Blueprints = append(section.Blueprints, documentBlueprint{Name: finding.Blueprint})
+			}
+
+			documented := documentFinding{Severity: finding.Severity, Message: finding.text()}
+			if finding.FileName != "" {
+				uri := uris.uri(finding.FileName)
+				documented.Location = finding.FileName
+				documented.Link = linkBaseURL + uri
+				if finding.Line > 0 {
+					documented.Location = fmt.Sprintf("%s:%d", finding.FileName, finding.Line)
+					documented.Link += fmt.Sprintf("#L%d", finding.Line)
+				}
+			}
+			section.Blueprints[index].Findings = append(section.Blueprints[index].Findings, documented)
+		}
+
+		sort.Slice(section.Blueprints, func(i, j int) bool { return section.Blueprints[i].Name < section.Blueprints[j].Name })
+		report.ByCheck = append(report.ByCheck, checkRow)
+		report.Checks = append(report.Checks, section)
+	}
+
+	for _, row := range dcEnvRows {
+		report.ByDcEnv = append(report.ByDcEnv, *row)
+	}
+	sort.Slice(report.ByDcEnv, func(i, j int) bool { return report.ByDcEnv[i].Name < report.ByDcEnv[j].Name })
+
+	return report
+}
+
+// markdownEscaper escapes the characters with a meaning in Markdown tables and text
+var markdownEscaper = strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`", "<", "&lt;", ">", "&gt;", "\n", "<br>")
+
+// writeMarkdownReport writes the findings as Markdown with collapsible details per blueprint
+func writeMarkdownReport(w io.Writer, run checkRun, config *Config) error {
+	return writeMarkdownDocument(w, newDocumentReport(run.results, config, config.Application.ReportLinkBaseURL))
+}
+
+// writeMarkdownDocument writes a report as Markdown
+func writeMarkdownDocument(w io.Writer, report documentReport) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s\n\nGenerated at %s\n", report.Title, report.GeneratedAt)
+
+	for _, table := range []struct {
+		title string
+		rows  []documentSummaryRow
+	}{
+		{"dc-env", report.ByDcEnv},
+		{"Check", report.ByCheck},
+	} {
+		fmt.Fprintf(&b, "\n| %s | Errors | Warnings | Info | Suppressed |\n|---|---:|---:|---:|---:|\n", table.title)
+		for _, row := range table.rows {
+			fmt.Fprintf(&b, "| %s | %d | %d | %d | %d |\n", markdownEscaper.Replace(row.Name), row.Errors, row.Warnings, row.Info, row.Suppressed)
+		}
+	}
+
+	for _, check := range report.Checks {
+		fmt.Fprintf(&b, "\n## %s\n\n", check.Title)
+		if len(check.Blueprints) == 0 {
+			fmt.Fprintf(&b, "Everything looks clean\n")
+			continue
+		}
+		for _, blueprint := range check.Blueprints {
+			fmt.Fprintf(&b, "<details>\n<summary>%s (%d)</summary>\n\n", template.HTMLEscapeString(blueprint.Name), len(blueprint.Findings))
+			for _, finding := range blueprint.Findings {
+				fmt.Fprintf(&b, "- **%s** %s", finding.Severity, markdownEscaper.Replace(finding.Message))
+				if finding.Link != "" {
+					fmt.Fprintf(&b, " ([%s](%s))", markdownEscaper.Replace(finding.Location), finding.Link)
+				}
+				fmt.Fprintf(&b, "\n")
+			}
+			fmt.Fprintf(&b, "\n</details>\n\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// htmlReportTemplate is a self-contained page, without external stylesheets or scripts
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; }
+td.count { text-align: right; }
+summary { cursor: pointer; font-weight: bold; margin: 4px 0; }
+.error { color: #b00020; }
+.warning { color: #a15c00; }
+.info { color: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated at {{.GeneratedAt}}</p>
+{{range $table := .Tables}}
+<table>
+<tr><th>{{$table.Title}}</th><th>Errors</th><th>Warnings</th><th>Info</th><th>Suppressed</th></tr>
+{{range $table.Rows}}<tr><td>{{.Name}}</td><td class="count">{{.Errors}}</td><td class="count">{{.Warnings}}</td><td class="count">{{.Info}}</td><td class="count">{{.Suppressed}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Checks}}
+<h2>{{.Title}}</h2>
+{{if not .Blueprints}}<p>Everything looks clean</p>{{end}}
+{{range .Blueprints}}<details>
+<summary>{{.Name}} ({{len .Findings}})</summary>
+<ul>
+{{range .Findings}}<li><span class="{{.Severity}}">{{.Severity}}</span> {{.Message}}{{if .Link}} (<a href="{{.Link}}">{{.Location}}</a>){{end}}</li>
+{{end}}</ul>
+</details>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// writeHTMLReport writes the findings as a self-contained HTML page with collapsible details per blueprint
+func writeHTMLReport(w io.Writer, run checkRun, config *Config) error {
+	report := newDocumentReport(run.results, config, config.Application.ReportLinkBaseURL)
+
+	type summaryTable struct {
+		Title string
+		Rows  []documentSummaryRow
+	}
+	return htmlReportTemplate.Execute(w, struct {
+		documentReport
+		Tables []summaryTable
+	}{report, []summaryTable{{"dc-env", report.ByDcEnv}, {"Check", report.ByCheck}}})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Finding severities
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// Finding is a cleanup suggestion produced by a check
+type Finding struct {
+	Check     string `json:"check"`
+	Severity  string `json:"severity"`
+	Blueprint string `json:"blueprint"`
+	Dc        string `json:"dc,omitempty"`
+	Env       string `json:"env,omitempty"`
+	VM        string `json:"vm,omitempty"`
+	FileName  string `json:"file"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	// Path is the YAML path of the node of the finding, e.g. environment_specific[0].virtual_machines[1]
+	Path        string   `json:"path,omitempty"`
+	Message     string   `json:"message"`
+	Maintainers []string `json:"maintainers,omitempty"`
+	// NextWindow is the start of the next patch window the finding happens in, kept out of the message so it stays the same across runs
+	NextWindow *time.Time `json:"next_window,omitempty"`
+	// LastChange is the last commit that touched the finding, set with -blame
+	LastChange *gitChange `json:"last_change,omitempty"`
+	// Fingerprint is the findingFingerprint written to the JSON findings, for the waivers of a single finding
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// newFinding creates a finding about a blueprint or update blueprint file
+func newFinding(check string, severity string, yamlData map[string]interface{}, fileName string, message string) Finding {
+	return Finding{
+		Check:       check,
+		Severity:    severity,
+		Blueprint:   blueprintPBN(yamlData),
+		FileName:    fileName,
+		Message:     message,
+		Maintainers: blueprintMaintainers(yamlData),
+	}
+}
+
+// inEnvironment sets the dc-env of the finding
+func (f Finding) inEnvironment(dc string, env string) Finding {
+	f.Dc = dc
+	f.Env = env
+	return f
+}
+
+// forVM sets the virtual machine of the finding
+func (f Finding) forVM(vm string) Finding {
+	f.VM = vm
+	return f
+}
+
+// at sets the YAML path, line and column of the node at a path of the finding file, e.g. "environment_specific", 0, "virtual_machines", 1
+func (f Finding) at(path ...interface{}) Finding {
+	f.Line, f.Column = yamlPosition(f.FileName, path...)
+	f.Path = yamlPath(path...)
+	return f
+}
+
+// atEnvironment sets the line and column of the node at a path of the environment_specific entry of the finding dc-env,
+// the finding keeps its file-level position when the entry isn't found
+func (f Finding) atEnvironment(path ...interface{}) Finding {
+	index := yamlEnvironmentIndex(f.FileName, f.Dc, f.Env)
+	if index < 0 {
+		return f
+	}
+	return f.at(append([]interface{}{"environment_specific", index}, path...)...)
+}
+
+// text returns the message of the finding with its next patch window when known
+func (f Finding) text() string {
+	if f.NextWindow != nil {
+		return fmt.Sprintf("%s (next window %s)", f.Message, f.NextWindow.Format(time.RFC3339))
+	}
+	return f.Message
+}
+
+// describe returns the text of the finding with its position and last change when known
+func (f Finding) describe() string {
+	description := f.text()
+	if f.Line > 0 {
+		description += fmt.Sprintf(" (%s:%d:%d)", f.FileName, f.Line, f.Column)
+	}
+	if f.LastChange != nil {
+		description += fmt.Sprintf(" (%s)", f.LastChange)
+	}
+	return description
+}
+
+// blueprintMaintainers returns the maintainers groups of a blueprint
+func blueprintMaintainers(yamlData map[string]interface{}) []string {
+	var maintainers []string
+
+	if maintainerList, ok := yamlData["maintainers"].([]interface{}); ok {
+		for _, maintainer := range maintainerList {
+			if name, ok := maintainer.(string); ok {
+				maintainers = append(maintainers, name)
+			}
+		}
+	}
+
+	return maintainers
+}
+
+// checkResult holds the findings of one check scope
+type checkResult struct {
+	Scope    string
+	Title    string
+	Findings []Finding
+	// Suppressed holds the findings covered by a waiver
+	Suppressed []Finding
+}
+
+// repositoryFiles lazily lists the blueprints and update blueprints files shared by the checks, along with the Azure VMs of the run
+type repositoryFiles struct {
+	config                    *Config
+	blueprintsFileNames       []string
+	updateBlueprintsFileNames []string
+	changed                   *changedScope
+	vms                       *azureVMs
+}
+
+// azureVMs returns the Azure VM lookups of the run
+func (r *repositoryFiles) azureVMs() *azureVMs {
+	if r.vms == nil {
+		r.vms = &azureVMs{subscription: r.config.Azure.Subscription, lookups: make(map[string]azureVMLookup)}
+	}
+	return r.vms
+}
+
+// allBlueprints lists every blueprint, e.g. to resolve the references of update blueprints
+func (r *repositoryFiles) allBlueprints() ([]string, error) {
+	if r.blueprintsFileNames == nil {
+		fileNames, err := getAllYAMLFiles(r.config.Application.BlueprintsDirectoryPath, r.config)
+		if err != nil {
+			return nil, err
+		}
+		r.blueprintsFileNames = fileNames
+	}
+	return r.blueprintsFileNames, nil
+}
+
+// allUpdateBlueprints lists every update blueprint
+func (r *repositoryFiles) allUpdateBlueprints() ([]string, error) {
+	if r.updateBlueprintsFileNames == nil {
+		fileNames, err := getAllYAMLFiles(r.config.Application.UpdateBlueprintsDirectoryPath, r.config)
+		if err != nil {
+			return nil, err
+		}
+		r.updateBlueprintsFileNames = fileNames
+	}
+	return r.updateBlueprintsFileNames, nil
+}
+
+// changedScope lists the files changed since the -changed-since git ref, nil without it
+func (r *repositoryFiles) changedScope() (*changedScope, error) {
+	if r.config.changedSince == "" || r.changed != nil {
+		return r.changed, nil
+	}
+
+	blueprintsFileNames, err := r.allBlueprints()
+	if err != nil {
+		return nil, err
+	}
+	updateBlueprintsFileNames, err := r.allUpdateBlueprints()
+	if err != nil {
+		return nil, err
+	}
+	r.changed, err = newChangedScope(r.config.changedSince, blueprintsFileNames, updateBlueprintsFileNames, r.config)
+
+	return r.changed, err
+}
+
+// blueprints lists the blueprints to check
+func (r *repositoryFiles) blueprints() ([]string, error) {
+	changed, err := r.changedScope()
+	if err != nil {
+		return nil, err
+	}
+	if changed != nil {
+		return changed.blueprints, nil
+	}
+	return r.allBlueprints()
+}
+
+// updateBlueprints lists the update blueprints to check
+func (r *repositoryFiles) updateBlueprints() ([]string, error) {
+	changed, err := r.changedScope()
+	if err != nil {
+		return nil, err
+	}
+	if changed != nil {
+		return changed.updateBlueprints, nil
+	}
+	return r.allUpdateBlueprints()
+}
+
+// skippedCheck is returned by checks that can't run with the current configuration
+type skippedCheck struct {
+	reason string
+}
+
+func (s skippedCheck) Error() string {
+	return s.reason
+}
+
+// check is a check that can be selected with -scope
+type check struct {
+	Scope string
+	Title string
+	Run   func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error)
+}
+
+// checks lists every check in the order they run with -scope all
+var checks = []check{
+	{"update-blueprints", "Update Blueprints", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		// Update blueprints can reference any blueprint
+		blueprintsFileNames, err := files.allBlueprints()
+		if err != nil {
+			return nil, err
+		}
+		updateBlueprintsFileNames, err := files.updateBlueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkUpdateBlueprints(blueprintsFileNames, updateBlueprintsFileNames, config), nil
+	}},
+	{"blueprints", "Blueprints", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		blueprintsFileNames, err := files.blueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkBlueprints(blueprintsFileNames, files.azureVMs(), config), nil
+	}},
+	{"blueprints-ips", "Blueprint IPs", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		blueprintsFileNames, err := files.blueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkBlueprintsIPs(blueprintsFileNames, files.azureVMs(), config), nil
+	}},
+	{"update-blueprints-schedule", "Update Blueprints Schedule", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		updateBlueprintsFileNames, err := files.updateBlueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkUpdateBlueprintsSchedule(updateBlueprintsFileNames, config, weeks), nil
+	}},
+	{"update-blueprints-loadbalancers", "Update Blueprints Load Balancers", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		// Update blueprints can reference any blueprint
+		blueprintsFileNames, err := files.allBlueprints()
+		if err != nil {
+			return nil, err
+		}
+		updateBlueprintsFileNames, err := files.updateBlueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkUpdateBlueprintsLoadBalancers(blueprintsFileNames, updateBlueprintsFileNames, config, weeks), nil
+	}},
+	{"update-blueprints-scripts", "Update Blueprints Scripts", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		updateBlueprintsFileNames, err := files.updateBlueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkUpdateBlueprintsScripts(updateBlueprintsFileNames, config), nil
+	}},
+	{"blueprints-alerts", "Blueprints Alerts", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		blueprintsFileNames, err := files.blueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkBlueprintsAlerts(blueprintsFileNames, config), nil
+	}},
+	{"blueprints-alert-rules", "Blueprints Alert Rules", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		blueprintsFileNames, err := files.blueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkBlueprintsAlertRules(blueprintsFileNames, config), nil
+	}},
+	{"blueprints-ownership", "Blueprints Ownership", func(files *repositoryFiles, config *Config, weeks int) ([]Finding, error) {
+		blueprintsFileNames, err := files.blueprints()
+		if err != nil {
+			return nil, err
+		}
+		return checkBlueprintsOwnership(blueprintsFileNames, config)
+	}},
+}
+
+// checkRun holds the results of a run of the checks along with the repository files and Azure VMs they looked at
+type checkRun struct {
+	results []checkResult
+	files   *repositoryFiles
+}
+
+// runChecks runs the checks selected by scope on the repository files and returns their findings
+func runChecks(files *repositoryFiles, scope string, config *Config, weeks int) ([]checkResult, error) {
+	scopes := make(map[string]bool)
+	for _, c := range checks {
+		if scope == c.Scope || scope == "all" {
+			scopes[c.Scope] = true
+		}
+	}
+	return runScopes(files, scopes, config, weeks)
+}
+
+// runScopes runs the checks of the scopes on the repository files and returns their findings
+func runScopes(files *repositoryFiles, scopes map[string]bool, config *Config, weeks int) ([]checkResult, error) {
+	var results []checkResult
+
+	waivers, waiverFindings, err := loadWaivers(files, config, scopes, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("error loading waivers: %v", err)
+	}
+
+	for _, c := range checks {
+		if !scopes[c.Scope] {
+			continue
+		}
+
+		findings, err := c.Run(files, config, weeks)
+		var skipped skippedCheck
+		if errors.As(err, &skipped) {
+			slog.Warn("Skipping check", "scope", c.Scope, "reason", err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error running %s check: %v", c.Scope, err)
+		}
+		reported, suppressed := applyWaivers(findings, waivers)
+		results = append(results, checkResult{Scope: c.Scope, Title: c.Title, Findings: reported, Suppressed: suppressed})
+	}
+
+	// Invalid and expired waivers
+	if len(waiverFindings) > 0 {
+		results = append(results, checkResult{Scope: "waivers", Title: "Waivers", Findings: waiverFindings})
+	}
+
+	return results, nil
+}
+
+// printCleanup writes the cleanup suggestions of a check to the report
+func printCleanup(w io.Writer, result checkResult, config *Config) error {
+	var suppressed string
+	if len(result.Suppressed) > 0 {
+		suppressed = fmt.Sprintf("# %d suppressed by waivers\n", len(result.Suppressed))
+	}
+
+	if len(result.Findings) == 0 {
+		_, err := fmt.Fprintf(w, "\n\n#############################\n# Everything looks clean\n# %s\n%s#############################\n", result.Title, suppressed)
+		return err
+	}
+
+	var cleanup string
+	for _, finding := range result.Findings {
+		cleanup += finding.describe() + "\n"
+	}
+	_, err := fmt.Fprintf(w, "\n\n#############################\n# Cleanup suggestions %s-%s\n# %s\n%s#############################\n%s\n#############################\n", config.Application.Dc, config.Application.Env, result.Title, suppressed, cleanup)
+	return err
+}
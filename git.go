@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// runGit runs a git command in a directory and returns its output
+func runGit(directoryPath string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", directoryPath}, args...)...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("error executing git %s: %v\nOutput: %s", strings.Join(args, " "), err, exitErr.Stderr)
+		}
+		return "", fmt.Errorf("error executing git %s: %v", strings.Join(args, " "), err)
+	}
+
+	return string(output), nil
+}
+
+// canonicalPath makes paths given relative, absolute or through symlinks comparable
+func canonicalPath(path string) string {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolvedPath, err := filepath.EvalSymlinks(absolutePath); err == nil {
+		return resolvedPath
+	}
+	return absolutePath
+}
+
+// gitChanges holds the files of a directory changed since a git ref
+type gitChanges struct {
+	// Changed holds the canonical paths of the added, modified, renamed and untracked files
+	Changed map[string]bool
+	// Removed holds the paths, relative to the repository, of the deleted and renamed files at the ref
+	Removed []string
+	// Repository is the top level directory of the git repository
+	Repository string
+}
+
+// gitChangedFiles lists the files of the git repository of a directory changed since a ref, including uncommitted changes
+func gitChangedFiles(directoryPath string, ref string) (*gitChanges, error) {
+	topLevel, err := runGit(directoryPath, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	changes := &gitChanges{Changed: make(map[string]bool), Repository: strings.TrimSpace(topLevel)}
+
+	diff, err := runGit(changes.Repository, "diff", "--name-status", "-M", "-z", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	// -z separates the status and the paths with NUL, renames and copies have the old and the new path
+	fields := strings.Split(strings.TrimSuffix(diff, "\x00"), "\x00")
+	for i := 0; i < len(fields) && fields[i] != ""; {
+		status := fields[i]
+		switch status[0] {
+		case 'R', 'C':
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("error parsing git diff output")
+			}
+			if status[0] == 'R' {
+				changes.Removed = append(changes.Removed, fields[i+1])
+			}
+			changes.Changed[canonicalPath(filepath.Join(changes.Repository, fields[i+2]))] = true
+			i += 3
+		case 'D':
+			changes.Removed = append(changes.Removed, fields[i+1])
+			i += 2
+		default:
+			changes.Changed[canonicalPath(filepath.Join(changes.Repository, fields[i+1]))] = true
+			i += 2
+		}
+	}
+
+	untracked, err := runGit(changes.Repository, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	for _, fileName := range strings.Split(untracked, "\x00") {
+		if fileName != "" {
+			changes.Changed[canonicalPath(filepath.Join(changes.Repository, fileName))] = true
+		}
+	}
+
+	return changes, nil
+}
+
+// gitFileYAML parses a file of the repository as it was at a ref
+func gitFileYAML(repository string, ref string, fileName string) (map[string]interface{}, error) {
+	content, err := runGit(repository, "show", ref+":"+fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &yamlData); err != nil {
+		return nil, fmt.Errorf("error parsing file %s at %s to YAML: %v", fileName, ref, err)
+	}
+
+	return yamlData, nil
+}
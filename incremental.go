@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// changedScope holds the blueprints and update blueprints files checked with -changed-since
+type changedScope struct {
+	blueprints       []string
+	updateBlueprints []string
+}
+
+// updateBlueprintReferences returns the blueprints patched by every environment of an update blueprint
+func updateBlueprintReferences(yamlData map[string]interface{}) []string {
+	var references []string
+	for _, envMap := range environmentEntries(yamlData) {
+		references = append(references, environmentInfrastructureBlueprints(envMap)...)
+	}
+	return references
+}
+
+// isInDirectory checks if a canonical path is inside a directory
+func isInDirectory(path string, directoryPath string) bool {
+	return strings.HasPrefix(path, canonicalPath(directoryPath)+string(filepath.Separator))
+}
+
+// updateBlueprintsInScope returns the update blueprints whose canonical path changed or referencing one of the blueprints,
+// referenced holds lowercased PBNs as the references are matched regardless of case
+func updateBlueprintsInScope(updateBlueprintsFileNames []string, changed map[string]bool, referenced map[string]bool) []string {
+	var inScope []string
+	for _, file := range loadYAMLFiles(updateBlueprintsFileNames) {
+		fileInScope := changed[canonicalPath(file.FileName)]
+		for _, reference := range updateBlueprintReferences(file.Data) {
+			fileInScope = fileInScope || referenced[strings.ToLower(reference)]
+		}
+		if fileInScope {
+			inScope = append(inScope, file.FileName)
+		}
+	}
+	return inScope
+}
+
+// newChangedScope restricts the files to the blueprints and update blueprints changed since a git ref,
+// plus the update blueprints referencing a changed, deleted or renamed blueprint
+func newChangedScope(ref string, blueprintsFileNames []string, updateBlueprintsFileNames []string, config *Config) (*changedScope, error) {
+	blueprintsChanges, err := gitChangedFiles(config.Application.BlueprintsDirectoryPath, ref)
+	if err != nil {
+		return nil, err
+	}
+	updateBlueprintsChanges, err := gitChangedFiles(config.Application.UpdateBlueprintsDirectoryPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := &changedScope{}
+	referenced := make(map[string]bool)
+
+	for _, fileName := range blueprintsFileNames {
+		if blueprintsChanges.Changed[canonicalPath(fileName)] {
+			scope.blueprints = append(scope.blueprints, fileName)
+		}
+	}
+	for _, file := range loadYAMLFiles(scope.blueprints) {
+		referenced[strings.ToLower(blueprintPBN(file.Data))] = true
+	}
+
+	// Update blueprints of deleted or renamed blueprints may now reference nothing
+	for _, removed := range blueprintsChanges.Removed {
+		extension := filepath.Ext(removed)
+		if extension != ".yaml" && extension != ".yml" {
+			continue
+		}
+		if !isInDirectory(filepath.Join(blueprintsChanges.Repository, removed), config.Application.BlueprintsDirectoryPath) {
+			continue
+		}
+		yamlData, err := gitFileYAML(blueprintsChanges.Repository, ref, removed)
+		if err != nil {
+			slog.Warn("Error reading removed blueprint", "file", removed, "error", err)
+			continue
+		}
+		slog.Info("Blueprint was deleted or renamed", "blueprint", blueprintPBN(yamlData), "since", ref)
+		referenced[strings.ToLower(blueprintPBN(yamlData))] = true
+	}
+
+	scope.updateBlueprints = updateBlueprintsInScope(updateBlueprintsFileNames, updateBlueprintsChanges.Changed, referenced)
+
+	slog.Info("Checking changed files", "blueprints", len(scope.blueprints), "update_blueprints", len(scope.updateBlueprints), "since", ref)
+
+	return scope, nil
+}
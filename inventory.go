@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// azureVM holds the details of a virtual machine returned by az vm show -d
+type azureVM struct {
+	HardwareProfile struct {
+		VMSize string `json:"vmSize"`
+	} `json:"hardwareProfile"`
+	PowerState string `json:"powerState"`
+	PrivateIps string `json:"privateIps"`
+}
+
+// errResourceGroupNotFound is returned when the resource group of a virtual machine doesn't exist
+var errResourceGroupNotFound = errors.New("resource group not found")
+
+// getAzureVM returns the details of a virtual machine using Azure CLI, nil when it doesn't exist
+func getAzureVM(subscription, resourceGroup, vmName string) (*azureVM, error) {
+	output, err := azureCLI("vm", "show", "--name", vmName, "--resource-group", resourceGroup, "--subscription", subscription, "-d", "--output", "json")
+	if err != nil {
+		// Check if the VM or resource group not found error occurred
+		if strings.Contains(string(output), "ResourceGroupNotFound") {
+			return nil, fmt.Errorf("%w: %s", errResourceGroupNotFound, resourceGroup)
+		}
+		if strings.Contains(string(output), "ResourceNotFound") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error executing Azure CLI command: %v\nOutput: %s", err, output)
+	}
+
+	var vm azureVM
+	if err := json.Unmarshal(output, &vm); err != nil {
+		return nil, fmt.Errorf("error parsing Azure CLI output: %v", err)
+	}
+
+	return &vm, nil
+}
+
+// azureVMLookup is the answer of Azure about a virtual machine
+type azureVMLookup struct {
+	vm  *azureVM
+	err error
+}
+
+// azureVMs looks up every virtual machine of a run once, the checks and the inventory share the answers
+type azureVMs struct {
+	subscription string
+	lookups      map[string]azureVMLookup
+}
+
+// get returns the details of a virtual machine like getAzureVM, looking it up in Azure the first time only
+func (a *azureVMs) get(resourceGroup, vmName string) (*azureVM, error) {
+	key := resourceGroup + "/" + vmName
+	lookup, ok := a.lookups[key]
+	if !ok {
+		lookup.vm, lookup.err = getAzureVM(a.subscription, resourceGroup, vmName)
+		a.lookups[key] = lookup
+	}
+	return lookup.vm, lookup.err
+}
+
+// instanceVMName returns the name of an instance of a VM group, Windows VMs are named after the group only
+func instanceVMName(envMap map[interface{}]interface{}, yamlData map[string]interface{}, vmMap map[interface{}]interface{}, index int) string {
+	name, _ := vmMap["name"].(string)
+	if os, _ := vmMap["os"].(string); strings.EqualFold(os, "windows") {
+		return fmt.Sprintf("%s-%d", name, index)
+	}
+	return constructVMName(envMap, yamlData, name, index)
+}
+
+// declaredIPs returns the addresses of an instance in every network of a VM group
+func declaredIPs(vmMap map[interface{}]interface{}, index int) []string {
+	var ips []string
+
+	networks, _ := vmMap["networks"].([]interface{})
+	for _, network := range networks {
+		if networkMap, ok := network.(map[interface{}]interface{}); ok {
+			if addresses, ok := networkMap["address"].([]interface{}); ok && index <= len(addresses) {
+				ips = append(ips, fmt.Sprint(addresses[index-1]))
+			}
+		}
+	}
+
+	return ips
+}
+
+// inventoryRow is an expected VM instance of a blueprint compared with Azure
+type inventoryRow struct {
+	Datacenter    string   `json:"datacenter"`
+	Environment   string   `json:"environment"`
+	Blueprint     string   `json:"blueprint"`
+	VMGroup       string   `json:"vm_group"`
+	Instance      int      `json:"instance"`
+	ExpectedName  string   `json:"expected_name"`
+	ResourceGroup string   `json:"resource_group"`
+	DeclaredIPs   []string `json:"declared_ips"`
+	ActualIPs     []string `json:"actual_ips"`
+	// Exists is nil when Azure could not be queried
+	Exists     *bool  `json:"exists"`
+	Size       string `json:"size"`
+	ActualSize string `json:"actual_size"`
+	Status     string `json:"status"`
+}
+
+// buildInventory returns a row per expected VM instance of the blueprints in the dc-env, compared with the Azure VMs of the run
+func buildInventory(blueprints []yamlFile, vms *azureVMs, config *Config) []inventoryRow {
+	var rows []inventoryRow
+
+	for _, file := range blueprints {
+		for _, envMap := range environmentEntries(file.Data) {
+			if envMap["environment"] != config.Application.Env || envMap["datacenter"] != config.Application.Dc {
+				continue
+			}
+
+			resourceGroup := constructResourceGroupName(envMap, file.Data)
+			vmList, _ := envMap["virtual_machines"].([]interface{})
+			for _, vm := range vmList {
+				vmMap, ok := vm.(map[interface{}]interface{})
+				if !ok {
+					continue
+				}
+				group, _ := vmMap["name"].(string)
+				size, _ := vmMap["type"].(string)
+				count, _ := vmMap["count"].(int)
+
+				for i := 1; i <= count; i++ {
+					row := inventoryRow{
+						Datacenter:    config.Application.Dc,
+						Environment:   config.Application.Env,
+						Blueprint:     blueprintPBN(file.Data),
+						VMGroup:       group,
+						Instance:      i,
+						ExpectedName:  instanceVMName(envMap, file.Data, vmMap, i),
+						ResourceGroup: resourceGroup,
+						DeclaredIPs:   declaredIPs(vmMap, i),
+						Size:          size,
+						Status:        "unknown",
+					}
+					slog.Debug("Looking up VM in Azure", "vm", row.ExpectedName)
+
+					azure, err := vms.get(resourceGroup, row.ExpectedName)
+					if errors.Is(err, errResourceGroupNotFound) {
+						azure, err = nil, nil
+					}
+					if err != nil {
+						slog.Error("Error looking up VM", "vm", row.ExpectedName, "error", err)
+					} else {
+						exists := azure != nil
+						row.Exists = &exists
+						row.Status = "missing"
+						if exists {
+							row.ActualSize, row.Status = azure.HardwareProfile.VMSize, azure.PowerState
+							if azure.PrivateIps != "" {
+								row.ActualIPs = strings.Split(azure.PrivateIps, ",")
+							}
+						}
+					}
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// writeInventoryCSV writes a row per expected VM instance of the target blueprints in the dc-env, compared with the Azure VMs looked up by the checks
+func writeInventoryCSV(w io.Writer, run checkRun, config *Config) error {
+	blueprintsFileNames, err := run.files.blueprints()
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"datacenter", "environment", "blueprint", "vm_group", "instance", "expected_name", "resource_group", "declared_ips", "actual_ips", "exists", "size", "actual_size", "status"}); err != nil {
+		return err
+	}
+
+	for _, row := range buildInventory(targetFiles(loadYAMLFiles(blueprintsFileNames), config), run.files.azureVMs(), config) {
+		var exists string
+		if row.Exists != nil {
+			exists = strconv.FormatBool(*row.Exists)
+		}
+		if err := writer.Write([]string{
+			row.Datacenter, row.Environment, row.Blueprint, row.VMGroup, strconv.Itoa(row.Instance), row.ExpectedName, row.ResourceGroup,
+			strings.Join(row.DeclaredIPs, ";"), strings.Join(row.ActualIPs, ";"), exists, row.Size, row.ActualSize, row.Status,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Issue tracker labels and description marker of the bpcleaner tickets
+const (
+	ticketLabel        = "bpcleaner"
+	ticketMarkerPrefix = "bpcleaner-findings: "
+)
+
+// ticketMarkerRegex finds the findings fingerprint written at the end of a ticket description
+var ticketMarkerRegex = regexp.MustCompile(`(?m)^` + ticketMarkerPrefix + `([0-9a-f]+)\s*$`)
+
+// issueTracker is a client of a Jira-compatible REST API
+type issueTracker struct {
+	baseURL   string
+	project   string
+	issueType string
+	// user and token come from BPCLEANER_ISSUE_TRACKER_USER and BPCLEANER_ISSUE_TRACKER_TOKEN, basic authentication with a user, bearer without
+	user   string
+	token  string
+	client *http.Client
+}
+
+// ticket is an open issue created by bpcleaner
+type ticket struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Labels      []string `json:"labels"`
+		Description string   `json:"description"`
+	} `json:"fields"`
+}
+
+// blueprintTicket holds the findings of a blueprint in a dc-env, tracked by one ticket
+type blueprintTicket struct {
+	Blueprint string
+	Findings  []Finding
+}
+
+// newIssueTracker creates the client of the configured issue tracker
+func newIssueTracker(config *Config) (*issueTracker, error) {
+	if config.Application.IssueTrackerURL == "" || config.Application.IssueTrackerProject == "" {
+		return nil, fmt.Errorf("issueTrackerURL and issueTrackerProject not configured")
+	}
+
+	issueType := config.Application.IssueTrackerIssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+
+	return &issueTracker{
+		baseURL:   strings.TrimSuffix(config.Application.IssueTrackerURL, "/"),
+		project:   config.Application.IssueTrackerProject,
+		issueType: issueType,
+		user:      os.Getenv("BPCLEANER_ISSUE_TRACKER_USER"),
+		token:     os.Getenv("BPCLEANER_ISSUE_TRACKER_TOKEN"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// do calls the issue tracker API with a JSON body and decodes the JSON response into out when not nil
+func (t *issueTracker) do(method string, path string, body interface{}, out interface{}) error {
+	var requestBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(content)
+	}
+
+	request, err := http.NewRequest(method, t.baseURL+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if t.user != "" {
+		request.SetBasicAuth(t.user, t.token)
+	} else if t.token != "" {
+		request.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error calling issue tracker: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("error calling issue tracker %s %s: %s: %s", method, path, response.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing issue tracker response to %s %s: %v", method, path, err)
+	}
+
+	return nil
+}
+
+// openTickets returns the open bpcleaner tickets of a dc-env
+func (t *issueTracker) openTickets(dc string, env string) ([]ticket, error) {
+	jql := fmt.Sprintf(`project = "%s" AND labels = "%s" AND labels = "%s" AND statusCategory != Done`, jqlEscape(t.project), jqlEscape(ticketLabel), jqlEscape(environmentTicketLabel(dc, env)))
+
+	var tickets []ticket
+	for {
+		query := url.Values{}
+		query.Set("jql", jql)
+		query.Set("fields", "labels,description")
+		query.Set("startAt", fmt.Sprint(len(tickets)))
+		var page struct {
+			Issues []ticket `json:"issues"`
+			Total  int      `json:"total"`
+		}
+		if err := t.do(http.MethodGet, "/rest/api/2/search?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, page.Issues...)
+		if len(page.Issues) == 0 || len(tickets) >= page.Total {
+			return tickets, nil
+		}
+	}
+}
+
+// createTicket opens a ticket and returns its key
+func (t *issueTracker) createTicket(summary string, description string, labels []string) (string, error) {
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": t.project},
+			"issuetype":   map[string]string{"name": t.issueType},
+			"summary":     summary,
+			"description": description,
+			"labels":      labels,
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := t.do(http.MethodPost, "/rest/api/2/issue", body, &created); err != nil {
+		return "", err
+	}
+	return created.Key, nil
+}
+
+// updateTicket replaces the description of a ticket
+func (t *issueTracker) updateTicket(key string, description string) error {
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{"description": description},
+	}
+	return t.do(http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(key), body, nil)
+}
+
+// closeTicket comments on a ticket and moves it with the first transition to a done status
+func (t *issueTracker) closeTicket(key string, comment string) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(key)
+
+	var transitions struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := t.do(http.MethodGet, path+"/transitions", nil, &transitions); err != nil {
+		return err
+	}
+
+	for _, transition := range transitions.Transitions {
+		if transition.To.StatusCategory.Key != "done" {
+			continue
+		}
+		if err := t.do(http.MethodPost, path+"/comment", map[string]string{"body": comment}, nil); err != nil {
+			return err
+		}
+		return t.do(http.MethodPost, path+"/transitions", map[string]interface{}{"transition": map[string]string{"id": transition.ID}}, nil)
+	}
+
+	return fmt.Errorf("ticket %s has no transition to a done status", key)
+}
+
+// jqlEscape escapes a value quoted in a JQL query
+func jqlEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// environmentTicketLabel is the label of the tickets of a dc-env, e.g. bpcleaner-we1-dev
+func environmentTicketLabel(dc string, env string) string {
+	return fmt.Sprintf("%s-%s-%s", ticketLabel, dc, env)
+}
+
+// blueprintTicketLabel is the label deduplicating the tickets of a blueprint in a dc-env
+func blueprintTicketLabel(dc string, env string, blueprint string) string {
+	fingerprint := sha256.Sum256([]byte(strings.Join([]string{dc, env, blueprint}, "\x00")))
+	return fmt.Sprintf("%s-%s", ticketLabel, hex.EncodeToString(fingerprint[:])[:16])
+}
+
+// findingsFingerprint identifies the findings of a ticket regardless of their order and of their messages
+func findingsFingerprint(findings []Finding) string {
+	var fingerprints []string
+	for _, finding := range findings {
+		fingerprints = append(fingerprints, findingFingerprint(finding))
+	}
+	sort.Strings(fingerprints)
+
+	fingerprint := sha256.Sum256([]byte(strings.Join(fingerprints, "\n")))
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// ticketDescription lists the findings of a blueprint, ending with their fingerprint to only update the ticket when they change
+func ticketDescription(bt blueprintTicket, config *Config) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "bpcleaner found %d cleanup findings for blueprint %s in %s-%s.\n\n", len(bt.Findings), bt.Blueprint, config.Application.Dc, config.Application.Env)
+	for _, finding := range bt.Findings {
+		fmt.Fprintf(&b, "* [%s] %s\n", finding.Check, finding.describe())
+	}
+	if len(bt.Findings) > 0 && len(bt.Findings[0].Maintainers) > 0 {
+		fmt.Fprintf(&b, "\nMaintainers: %s\n", strings.Join(bt.Findings[0].Maintainers, ", "))
+	}
+	fmt.Fprintf(&b, "\n%s%s\n", ticketMarkerPrefix, findingsFingerprint(bt.Findings))
+
+	return b.String()
+}
+
+// groupFindingsByBlueprint returns the findings of every blueprint, in the order of their first finding
+func groupFindingsByBlueprint(findings []Finding) []*blueprintTicket {
+	byBlueprint := make(map[string]*blueprintTicket)
+	var grouped []*blueprintTicket
+	for _, finding := range findings {
+		bt, ok := byBlueprint[finding.Blueprint]
+		if !ok {
+			bt = &blueprintTicket{Blueprint: finding.Blueprint}
+			byBlueprint[finding.Blueprint] = bt
+			grouped = append(grouped, bt)
+		}
+		bt.Findings = append(bt.Findings, finding)
+	}
+	return grouped
+}
+
+// checkedBlueprints returns the blueprints and update blueprints of the configured dc-env the checks ran on, whose tickets can be closed
+func checkedBlueprints(run checkRun, config *Config) map[string]bool {
+	checked := make(map[string]bool)
+	for _, result := range run.results {
+		for _, file := range checkedFiles(result.Scope, run.files, config) {
+			checked[blueprintPBN(file.Data)] = true
+		}
+	}
+	return checked
+}
+
+// syncTickets creates or updates a ticket per blueprint with findings and closes the tickets of the checked blueprints without findings
+func syncTickets(run checkRun, config *Config) error {
+	tracker, err := newIssueTracker(config)
+	if err != nil {
+		return err
+	}
+	dc, env := config.Application.Dc, config.Application.Env
+
+	tickets, err := tracker.openTickets(dc, env)
+	if err != nil {
+		return err
+	}
+	ticketsByLabel := make(map[string]ticket)
+	for _, t := range tickets {
+		for _, label := range t.Fields.Labels {
+			ticketsByLabel[label] = t
+		}
+	}
+
+	var findings []Finding
+	for _, result := range run.results {
+		findings = append(findings, result.Findings...)
+	}
+
+	synced := make(map[string]bool)
+	for _, bt := range groupFindingsByBlueprint(findings) {
+		label := blueprintTicketLabel(dc, env, bt.Blueprint)
+		synced[label] = true
+		description := ticketDescription(*bt, config)
+
+		existing, ok := ticketsByLabel[label]
+		if !ok {
+			summary := fmt.Sprintf("Cleanup blueprint %s in %s-%s", bt.Blueprint, dc, env)
+			key, err := tracker.createTicket(summary, description, []string{ticketLabel, environmentTicketLabel(dc, env), label})
+			if err != nil {
+				return err
+			}
+			slog.Info("Ticket created", "ticket", key, "blueprint", bt.Blueprint, "findings", len(bt.Findings))
+			continue
+		}
+
+		if marker := ticketMarkerRegex.FindStringSubmatch(existing.Fields.Description); marker != nil && marker[1] == findingsFingerprint(bt.Findings) {
+			slog.Debug("Ticket is up to date", "ticket", existing.Key, "blueprint", bt.Blueprint)
+			continue
+		}
+		if err := tracker.updateTicket(existing.Key, description); err != nil {
+			return err
+		}
+		slog.Info("Ticket updated", "ticket", existing.Key, "blueprint", bt.Blueprint, "findings", len(bt.Findings))
+	}
+
+	// Only the tickets of the blueprints checked by this run are resolved
+	for blueprint := range checkedBlueprints(run, config) {
+		label := blueprintTicketLabel(dc, env, blueprint)
+		existing, ok := ticketsByLabel[label]
+		if !ok || synced[label] {
+			continue
+		}
+		if err := tracker.closeTicket(existing.Key, fmt.Sprintf("bpcleaner found no more cleanup findings for blueprint %s in %s-%s.", blueprint, dc, env)); err != nil {
+			return err
+		}
+		slog.Info("Ticket closed", "ticket", existing.Key, "blueprint", blueprint)
+	}
+
+	return nil
+}
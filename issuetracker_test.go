@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeTestBlueprint writes a blueprint with environment_specific entries for the dc-envs, e.g. "we1-dev"
+func writeTestBlueprint(t *testing.T, directory string, name string, dcEnvs ...string) string {
+	t.Helper()
+
+	content := fmt.Sprintf("platform: infrastructure\nboundary: test\nname: %s\nmaintainers:\n  - team-test\n  - team-%s\nenvironment_specific:\n", name, name)
+	for _, dcEnv := range dcEnvs {
+		dc, env, _ := strings.Cut(dcEnv, "-")
+		content += fmt.Sprintf("  - environment: %s\n    datacenter: %s\n", env, dc)
+	}
+
+	fileName := filepath.Join(directory, name+".yaml")
+	if err := os.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+// fakeIssueTracker is a Jira-compatible API recording the calls of bpcleaner
+type fakeIssueTracker struct {
+	t        *testing.T
+	mu       sync.Mutex
+	tickets  []ticket
+	pageSize int
+	created  []map[string]interface{}
+	updated  map[string]string
+	comments map[string]string
+	closed   []string
+}
+
+func (f *fakeIssueTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	key := strings.Split(strings.TrimPrefix(r.URL.Path, "/rest/api/2/issue/"), "/")[0]
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/search":
+		if jql := r.URL.Query().Get("jql"); !strings.Contains(jql, `labels = "bpcleaner-we1-dev"`) {
+			f.t.Errorf("search jql = %s, want the dc-env label", jql)
+		}
+		start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		end := start + f.pageSize
+		if end > len(f.tickets) {
+			end = len(f.tickets)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"issues": f.tickets[start:end], "total": len(f.tickets)})
+	case r.Method == http.MethodPost && r.URL.Path == "/rest/api/2/issue":
+		f.created = append(f.created, body["fields"].(map[string]interface{}))
+		writeJSON(w, http.StatusCreated, map[string]string{"key": fmt.Sprintf("OPS-%d", 100+len(f.created))})
+	case r.Method == http.MethodPut:
+		f.updated[key] = body["fields"].(map[string]interface{})["description"].(string)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/transitions"):
+		writeJSON(w, http.StatusOK, map[string]interface{}{"transitions": []map[string]interface{}{
+			{"id": "11", "to": map[string]interface{}{"statusCategory": map[string]string{"key": "indeterminate"}}},
+			{"id": "31", "to": map[string]interface{}{"statusCategory": map[string]string{"key": "done"}}},
+		}})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/comment"):
+		f.comments[key] = body["body"].(string)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/transitions"):
+		if id := body["transition"].(map[string]interface{})["id"]; id != "31" {
+			f.t.Errorf("transition of %s = %v, want the done transition 31", key, id)
+		}
+		f.closed = append(f.closed, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.t.Errorf("unexpected call %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+// openTestTicket returns an open ticket of a blueprint in we1-dev with a description
+func openTestTicket(key string, blueprint string, description string) ticket {
+	var t ticket
+	t.Key = key
+	t.Fields.Labels = []string{ticketLabel, environmentTicketLabel("we1", "dev"), blueprintTicketLabel("we1", "dev", blueprint)}
+	t.Fields.Description = description
+	return t
+}
+
+func TestSyncTickets(t *testing.T) {
+	directory := t.TempDir()
+	newFile := writeTestBlueprint(t, directory, "new", "we1-dev")
+	changedFile := writeTestBlueprint(t, directory, "changed", "we1-dev")
+	unchangedFile := writeTestBlueprint(t, directory, "unchanged", "we1-dev")
+	writeTestBlueprint(t, directory, "fixed", "we1-dev")
+	writeTestBlueprint(t, directory, "elsewhere", "ne1-prd")
+
+	config := &Config{}
+	config.Application.BlueprintsDirectoryPath = directory
+	config.Application.Dc, config.Application.Env = "we1", "dev"
+	config.Application.TargetKey, config.Application.TargetValue = "maintainers", "team-test"
+	config.Application.IssueTrackerProject = "OPS"
+
+	finding := func(name string, fileName string, vm string) Finding {
+		return Finding{Check: "blueprints", Severity: severityError, Blueprint: "infrastructure-test-" + name, Dc: "we1", Env: "dev", VM: vm, FileName: fileName, Message: "VM " + vm + " doesn't exist"}
+	}
+	results := []checkResult{{Scope: "blueprints", Title: "Blueprints", Findings: []Finding{
+		finding("new", newFile, "vm-1"),
+		finding("changed", changedFile, "vm-1"),
+		finding("changed", changedFile, "vm-2"),
+		finding("unchanged", unchangedFile, "vm-1"),
+	}}}
+	unchanged := blueprintTicket{Blueprint: "infrastructure-test-unchanged", Findings: []Finding{finding("unchanged", unchangedFile, "vm-1")}}
+	// The fingerprint ignores the message
+	unchanged.Findings[0].Message = "Reworded message"
+
+	tracker := &fakeIssueTracker{
+		t: t,
+		tickets: []ticket{
+			openTestTicket("OPS-1", "infrastructure-test-changed", "bpcleaner-findings: 0123"),
+			openTestTicket("OPS-2", "infrastructure-test-unchanged", ticketDescription(unchanged, config)),
+			openTestTicket("OPS-3", "infrastructure-test-fixed", "bpcleaner-findings: 4567"),
+			openTestTicket("OPS-4", "infrastructure-test-elsewhere", "bpcleaner-findings: 89ab"),
+		},
+		pageSize: 3,
+		updated:  make(map[string]string),
+		comments: make(map[string]string),
+	}
+	server := httptest.NewServer(tracker)
+	defer server.Close()
+	config.Application.IssueTrackerURL = server.URL + "/"
+	t.Setenv("BPCLEANER_ISSUE_TRACKER_USER", "")
+	t.Setenv("BPCLEANER_ISSUE_TRACKER_TOKEN", "secret")
+
+	if err := syncTickets(checkRun{results: results, files: &repositoryFiles{config: config}}, config); err != nil {
+		t.Fatalf("syncTickets: %v", err)
+	}
+
+	if len(tracker.created) != 1 {
+		t.Fatalf("created %d tickets, want 1", len(tracker.created))
+	}
+	created := tracker.created[0]
+	if summary := created["summary"]; summary != "Cleanup blueprint infrastructure-test-new in we1-dev" {
+		t.Errorf("created ticket summary = %v", summary)
+	}
+	if issueType := created["issuetype"].(map[string]interface{})["name"]; issueType != "Task" {
+		t.Errorf("created ticket type = %v, want the default Task", issueType)
+	}
+	wantLabels := fmt.Sprint([]interface{}{ticketLabel, "bpcleaner-we1-dev", blueprintTicketLabel("we1", "dev", "infrastructure-test-new")})
+	if labels := fmt.Sprint(created["labels"]); labels != wantLabels {
+		t.Errorf("created ticket labels = %s, want %s", labels, wantLabels)
+	}
+
+	if len(tracker.updated) != 1 || !strings.Contains(tracker.updated["OPS-1"], "found 2 cleanup findings") {
+		t.Errorf("updated tickets = %v, want OPS-1 with its 2 findings", tracker.updated)
+	}
+	if fmt.Sprint(tracker.closed) != "[OPS-3]" {
+		t.Errorf("closed tickets = %v, want OPS-3 only, OPS-4 is not deployed in we1-dev", tracker.closed)
+	}
+	if !strings.Contains(tracker.comments["OPS-3"], "no more cleanup findings") {
+		t.Errorf("closing comment of OPS-3 = %q", tracker.comments["OPS-3"])
+	}
+}
+
+func TestSyncTicketsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "project OPS does not exist", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := &Config{}
+	config.Application.IssueTrackerURL = server.URL
+	config.Application.IssueTrackerProject = "OPS"
+
+	err := syncTickets(checkRun{files: &repositoryFiles{config: config}}, config)
+	if err == nil || !strings.Contains(err.Error(), "project OPS does not exist") {
+		t.Errorf("syncTickets error = %v, want the issue tracker error", err)
+	}
+}
+
+func TestJQLEscape(t *testing.T) {
+	if got, want := jqlEscape(`OPS" OR project = "SEC\`), `OPS\" OR project = \"SEC\\`; got != want {
+		t.Errorf("jqlEscape = %s, want %s", got, want)
+	}
+}
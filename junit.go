@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+)
+
+// JUnit XML report, as read by the CI test dashboards
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// fail adds a finding to the failure of a test case, the first one gives the failure message
+func (c *junitTestCase) fail(message string, finding Finding) {
+	if c.Failure == nil {
+		c.Failure = &junitFailure{Message: message, Type: finding.Severity}
+	} else if finding.Severity == severityError {
+		c.Failure.Type = severityError
+	}
+	c.Failure.Text = strings.TrimPrefix(c.Failure.Text+"\n"+finding.describe(), "\n")
+}
+
+// checkedFiles returns the files of the dc-env a check scope ran on, so the blueprints without findings are passing test cases
+func checkedFiles(scope string, files *repositoryFiles, config *Config) []yamlFile {
+	var fileNames []string
+	var err error
+	switch {
+	case scope == "waivers":
+		return nil
+	case strings.HasPrefix(scope, "update-blueprints"):
+		fileNames, err = files.updateBlueprints()
+	default:
+		fileNames, err = files.blueprints()
+	}
+	if err != nil {
+		return nil
+	}
+
+	var checked []yamlFile
+	for _, file := range targetFiles(loadYAMLFiles(fileNames), config) {
+		if deployedIn(file.Data, config) {
+			checked = append(checked, file)
+		}
+	}
+	return checked
+}
+
+// writeJUnitReport writes a test suite per check scope with a test case per blueprint, and per VM for VM findings,
+// a blueprint case fails with its VM cases
+func writeJUnitReport(w io.Writer, run checkRun, config *Config) error {
+	report := junitTestSuites{Name: "bpcleaner " + config.Application.Dc + "-" + config.Application.Env}
+
+	for _, result := range run.results {
+		suite := junitTestSuite{Name: result.Scope}
+		cases := make(map[string]*junitTestCase)
+		testCase := func(name string, fileName string) *junitTestCase {
+			if _, ok := cases[name]; !ok {
+				cases[name] = &junitTestCase{Name: name, ClassName: result.Scope, File: fileName}
+			}
+			return cases[name]
+		}
+
+		for _, file := range checkedFiles(result.Scope, run.files, config) {
+			testCase(blueprintPBN(file.Data), file.FileName)
+		}
+		for _, finding := range result.Findings {
+			name := finding.Blueprint
+			if finding.VM != "" {
+				name += " " + finding.VM
+				testCase(finding.Blueprint, finding.FileName)
+			}
+			c := testCase(name, finding.FileName)
+
+			// Info findings are reported without failing the test case
+			if finding.Severity == severityInfo {
+				c.SystemOut = strings.TrimPrefix(c.SystemOut+"\n"+finding.describe(), "\n")
+				continue
+			}
+			c.fail(finding.text(), finding)
+			if finding.VM != "" {
+				cases[finding.Blueprint].fail("VM "+finding.VM+": "+finding.text(), finding)
+			}
+		}
+
+		for _, finding := range result.Suppressed {
+			c := testCase(finding.Blueprint, finding.FileName)
+			c.SystemOut = strings.TrimPrefix(c.SystemOut+"\nSuppressed by a waiver: "+finding.describe(), "\n")
+		}
+
+		var names []string
+		for name := range cases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			suite.Cases = append(suite.Cases, *cases[name])
+			if cases[name].Failure != nil {
+				suite.Failures++
+			}
+		}
+		suite.Tests = len(suite.Cases)
+
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
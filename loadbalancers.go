@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lbBackend is a VM group of a blueprint placed behind a load balancer
+type lbBackend struct {
+	Blueprint string
+	VMGroup   string
+	Count     int
+	FileName  string
+}
+
+// loadBalancer holds the backends of a load balancer in a dc-env
+type loadBalancer struct {
+	Name     string
+	Type     string
+	Backends []lbBackend
+	// Target is true when at least one backend belongs to a target blueprint
+	Target bool
+}
+
+// instances returns the number of VMs behind the load balancer
+func (lb *loadBalancer) instances() int {
+	total := 0
+	for _, backend := range lb.Backends {
+		total += backend.Count
+	}
+	return total
+}
+
+// blueprintInstances returns the number of VMs of a blueprint behind the load balancer
+func (lb *loadBalancer) blueprintInstances(pbn string) int {
+	total := 0
+	for _, backend := range lb.Backends {
+		if strings.EqualFold(backend.Blueprint, pbn) {
+			total += backend.Count
+		}
+	}
+	return total
+}
+
+// patchedInstances returns how many VMs behind the load balancer an update blueprint takes down at once
+func (lb *loadBalancer) patchedInstances(blueprints []string, count int) int {
+	total := 0
+	for _, instances := range lb.patchedBlueprintInstances(blueprints, count) {
+		total += instances
+	}
+
+	// Without a count every VM is patched at the same time
+	if count > 0 && count < total {
+		return count
+	}
+	return total
+}
+
+// patchedBlueprintInstances returns, by backend blueprint, how many of its VMs behind the load balancer an update blueprint can take down at once
+func (lb *loadBalancer) patchedBlueprintInstances(blueprints []string, count int) map[string]int {
+	patched := make(map[string]int)
+	for _, blueprint := range blueprints {
+		key := strings.ToLower(blueprint)
+		if _, ok := patched[key]; ok {
+			continue
+		}
+		instances := lb.blueprintInstances(blueprint)
+		if count > 0 && count < instances {
+			instances = count
+		}
+		if instances > 0 {
+			patched[key] = instances
+		}
+	}
+	return patched
+}
+
+// collectLoadBalancers groups the VM groups of every blueprint in the configured dc-env by the load balancer they are behind.
+// Load balancers defined in the blueprint are qualified with its resource group, other references are kept as they are.
+func collectLoadBalancers(blueprints []yamlFile, config *Config) []*loadBalancer {
+	loadBalancers := make(map[string]*loadBalancer)
+	var order []string
+
+	for _, file := range blueprints {
+		target := isTargetBlueprint(file.Data, config)
+
+		for _, envMap := range environmentEntries(file.Data) {
+			if envMap["environment"] != config.Application.Env || envMap["datacenter"] != config.Application.Dc {
+				continue
+			}
+
+			// Load balancers defined by the blueprint itself
+			localTypes := make(map[string]string)
+			if lbList, ok := envMap["loadbalancers"].([]interface{}); ok {
+				for _, lb := range lbList {
+					if lbMap, ok := lb.(map[interface{}]interface{}); ok {
+						if name, ok := lbMap["name"].(string); ok {
+							lbType, _ := lbMap["type"].(string)
+							localTypes[name] = lbType
+						}
+					}
+				}
+			}
+
+			vmList, ok := envMap["virtual_machines"].([]interface{})
+			if !ok {
+				continue
+			}
+			for _, vm := range vmList {
+				vmMap, ok := vm.(map[interface{}]interface{})
+				if !ok {
+					continue
+				}
+				vmName, _ := vmMap["name"].(string)
+				count, _ := vmMap["count"].(int)
+
+				networkList, _ := vmMap["networks"].([]interface{})
+				for _, network := range networkList {
+					networkMap, ok := network.(map[interface{}]interface{})
+					if !ok {
+						continue
+					}
+					lbNames, _ := networkMap["loadbalancers"].([]interface{})
+					for _, lbName := range lbNames {
+						name, ok := lbName.(string)
+						if !ok {
+							continue
+						}
+
+						key := name
+						lbType, local := localTypes[name]
+						if local {
+							key = fmt.Sprintf("%s/%s", constructResourceGroupName(envMap, file.Data), name)
+						}
+
+						lb, ok := loadBalancers[key]
+						if !ok {
+							lb = &loadBalancer{Name: key, Type: lbType}
+							loadBalancers[key] = lb
+							order = append(order, key)
+						}
+						lb.Target = lb.Target || target
+						lb.Backends = append(lb.Backends, lbBackend{
+							Blueprint: blueprintPBN(file.Data),
+							VMGroup:   vmName,
+							Count:     count,
+							FileName:  file.FileName,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	var result []*loadBalancer
+	for _, key := range order {
+		result = append(result, loadBalancers[key])
+	}
+
+	return result
+}
+
+func checkUpdateBlueprintsLoadBalancers(blueprintsFileNames []string, updateBlueprintsFileNames []string, config *Config, weeks int) []Finding {
+	blueprints := loadYAMLFiles(blueprintsFileNames)
+	updateBlueprints := loadYAMLFiles(updateBlueprintsFileNames)
+
+	// Store cleanup guidance
+	var findings []Finding
+
+	// Patch windows of every team, backends of one load balancer can be patched by update blueprints of other teams
+	from, to := scheduleHorizon(weeks, config)
+	var windows []patchWindow
+	for _, window := range collectPatchWindows(updateBlueprints, from, to) {
+		if window.Dc == config.Application.Dc && window.Env == config.Application.Env {
+			windows = append(windows, window)
+		}
+	}
+
+	for _, lb := range collectLoadBalancers(blueprints, config) {
+		// Only the internal load balancers are checked
+		if !lb.Target || strings.EqualFold(lb.Type, "public") {
+			continue
+		}
+		backends := lb.instances()
+		if backends == 0 {
+			continue
+		}
+
+		// A single update blueprint taking down the whole pool
+		for _, file := range updateBlueprints {
+			for _, envMap := range environmentEntries(file.Data) {
+				if envMap["environment"] != config.Application.Env || envMap["datacenter"] != config.Application.Dc {
+					continue
+				}
+
+				_, count := environmentUpdateClassifications(envMap)
+				patched := lb.patchedInstances(environmentInfrastructureBlueprints(envMap), count)
+				if patched == 0 {
+					continue
+				}
+
+				if patched >= backends {
+					slog.Info("Update blueprint patches all backends of a load balancer at once", "update_blueprint", blueprintPBN(file.Data), "backends", backends, "loadbalancer", lb.Name)
+					findings = append(findings, newFinding("update-blueprints-loadbalancers", severityError, file.Data, file.FileName, fmt.Sprintf("Update blueprint %s-%s-%s patches %d VM(s) at once (update_classifications.count %d), taking down all %d backends of load balancer %s. Check file %s", blueprintPBN(file.Data), config.Application.Dc, config.Application.Env, patched, count, backends, lb.Name, file.FileName)).inEnvironment(config.Application.Dc, config.Application.Env).atEnvironment("update_classifications", "count"))
+				} else {
+					slog.Debug("Update blueprint patches part of the backends of a load balancer at once", "update_blueprint", blueprintPBN(file.Data), "patched", patched, "backends", backends, "loadbalancer", lb.Name)
+				}
+			}
+		}
+
+		// Several update blueprints sharing a window that together take down the whole pool
+		var lbWindows []patchWindow
+		for _, window := range windows {
+			if lb.patchedInstances(window.Blueprints, window.Count) > 0 {
+				lbWindows = append(lbWindows, window)
+			}
+		}
+
+		reported := make(map[string]bool)
+		firstOccurrence := make(map[string]patchWindow)
+		var order []string
+		for _, window := range lbWindows {
+			patchedByBlueprint := make(map[string]int)
+			sources := make(map[string]bool)
+			var updateBlueprintNames []string
+			for _, other := range lbWindows {
+				if !window.Start.Before(other.End) || !other.Start.Before(window.End) || sources[other.source] {
+					continue
+				}
+				sources[other.source] = true
+				updateBlueprintNames = append(updateBlueprintNames, other.UpdateBlueprint)
+				for blueprint, instances := range lb.patchedBlueprintInstances(other.Blueprints, other.Count) {
+					patchedByBlueprint[blueprint] += instances
+				}
+			}
+
+			// A backend blueprint can't lose more VMs than it has, whatever the number of update blueprints patching it
+			patched := 0
+			for blueprint, instances := range patchedByBlueprint {
+				patched += min(instances, lb.blueprintInstances(blueprint))
+			}
+
+			// A single update blueprint is already reported above
+			if len(sources) < 2 || patched < backends {
+				continue
+			}
+
+			sort.Strings(updateBlueprintNames)
+			message := fmt.Sprintf("Update blueprints %s share a patch window that takes down all %d backends of load balancer %s", strings.Join(updateBlueprintNames, ", "), backends, lb.Name)
+			if !reported[message] {
+				reported[message] = true
+				order = append(order, message)
+				firstOccurrence[message] = window
+			}
+		}
+		for _, message := range order {
+			window := firstOccurrence[message]
+			slog.Info(message, "next_window", window.Start.Format(time.RFC3339))
+			start := window.Start
+			findings = append(findings, Finding{
+				Check:       "update-blueprints-loadbalancers",
+				Severity:    severityError,
+				Blueprint:   window.UpdateBlueprint,
+				Dc:          window.Dc,
+				Env:         window.Env,
+				FileName:    window.FileName,
+				Message:     message,
+				Maintainers: window.Maintainers,
+				NextWindow:  &start,
+			}.atEnvironment("scheduling"))
+		}
+	}
+
+	return findings
+}
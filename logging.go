@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// outputOptions are the flags separating the logs, on stderr, from the report, on stdout or in a file
+type outputOptions struct {
+	logLevel  string
+	logFormat string
+	outFile   string
+}
+
+// register adds the output flags to a flag set
+func (o *outputOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.logLevel, "log-level", "info", "Log level on stderr: debug, info, warn or error")
+	flags.StringVar(&o.logFormat, "log-format", "text", "Log format on stderr: text or json")
+	flags.StringVar(&o.outFile, "out", "", "Write the report to this file instead of stdout")
+}
+
+// setupLogging makes the default slog logger write to stderr with the configured level and format
+func (o *outputOptions) setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.logLevel)); err != nil {
+		return fmt.Errorf("invalid log level %s, expected debug, info, warn or error", o.logLevel)
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(o.logFormat) {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, handlerOptions)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions)))
+	default:
+		return fmt.Errorf("invalid log format %s, expected text or json", o.logFormat)
+	}
+
+	return nil
+}
+
+// openReport returns where the report is written and a function closing it
+func (o *outputOptions) openReport() (io.Writer, func() error, error) {
+	if o.outFile == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	file, err := os.Create(o.outFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating report file: %v", err)
+	}
+	return file, file.Close, nil
+}
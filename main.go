@@ -4,10 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -20,33 +23,72 @@ type Config struct {
 	} `yaml:"azure"`
 
 	Application struct {
-		BlueprintsDirectoryPath       string `yaml:"blueprintsDirectoryPath"`
-		UpdateBlueprintsDirectoryPath string `yaml:"updateBlueprintsDirectoryPath"`
-		TargetKey                     string `yaml:"targetKey"`
-		TargetValue                   string `yaml:"targetValue"`
-		Env                           string `yaml:"env"`
-		Dc                            string `yaml:"dc"`
+		BlueprintsDirectoryPath       string   `yaml:"blueprintsDirectoryPath"`
+		UpdateBlueprintsDirectoryPath string   `yaml:"updateBlueprintsDirectoryPath"`
+		SaltStatesDirectoryPath       string   `yaml:"saltStatesDirectoryPath"`
+		AlertEnvironments             []string `yaml:"alertEnvironments"`
+		TeamDirectoryPath             string   `yaml:"teamDirectoryPath"`
+		IncludePaths                  []string `yaml:"includePaths"`
+		ExcludePaths                  []string `yaml:"excludePaths"`
+		WaiversPath                   string   `yaml:"waiversPath"`
+		ReportLinkBaseURL             string   `yaml:"reportLinkBaseURL"`
+		NotifyWebhookURL              string   `yaml:"notifyWebhookURL"`
+		NotifyFormat                  string   `yaml:"notifyFormat"`
+		IssueTrackerURL               string   `yaml:"issueTrackerURL"`
+		IssueTrackerProject           string   `yaml:"issueTrackerProject"`
+		IssueTrackerIssueType         string   `yaml:"issueTrackerIssueType"`
+		ScheduleTimeZone              string   `yaml:"scheduleTimeZone"`
+		TargetKey                     string   `yaml:"targetKey"`
+		TargetValue                   string   `yaml:"targetValue"`
+		Select                        string   `yaml:"select"`
+		Env                           string   `yaml:"env"`
+		Dc                            string   `yaml:"dc"`
 		// Add other application-specific parameters here
 	} `yaml:"application"`
+
+	// selector is the compiled Application.Select expression
+	selector selector
+	// changedSince restricts the checks to the files changed since this git ref
+	changedSince string
+	// scheduleLocation is the loaded Application.ScheduleTimeZone
+	scheduleLocation *time.Location
+	// allTeams makes every blueprint a target, ignoring the selector and the target key
+	allTeams bool
 }
 
-// getAllYAMLFiles recursively retrieves all YAML file names in the specified directory and its subdirectories, excluding .git directory
-func getAllYAMLFiles(directoryPath string) ([]string, error) {
+// getAllYAMLFiles recursively retrieves all YAML file names in the specified directory and its subdirectories,
+// excluding .git directory and the paths filtered by includePaths, excludePaths and the .bpcleanerignore file
+func getAllYAMLFiles(directoryPath string, config *Config) ([]string, error) {
 	var fileNames []string
 
+	filter, err := newPathFilter(directoryPath, config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Walk through the directory and its subdirectories
-	err := filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(directoryPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(directoryPath, path)
 		if err != nil {
 			return err
 		}
+		relativePath = filepath.ToSlash(relativePath)
 
-		// Skip .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
+		// Skip excluded directories
+		if info.IsDir() {
+			if relativePath != "." && filter.skipDir(relativePath) {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		// Check if it's a regular file with ".yaml" extension
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".yaml") {
+		// Check if it's a regular file with ".yaml" or ".yml" extension
+		extension := filepath.Ext(info.Name())
+		if (extension == ".yaml" || extension == ".yml") && filter.includesFile(relativePath) {
 			fileNames = append(fileNames, path)
 		}
 
@@ -60,135 +102,332 @@ func getAllYAMLFiles(directoryPath string) ([]string, error) {
 	return fileNames, nil
 }
 
+// yamlFile holds the parsed content of a blueprint or update blueprint file
+type yamlFile struct {
+	FileName string
+	Data     map[string]interface{}
+}
+
+// parsedYAMLFile is a parsed file with the modification time and size it was parsed at
+type parsedYAMLFile struct {
+	modTime time.Time
+	size    int64
+	data    map[string]interface{}
+}
+
+// parsedYAMLFiles caches the parsed files until they are modified, the checks never modify the parsed data
+var parsedYAMLFiles = struct {
+	sync.Mutex
+	files map[string]parsedYAMLFile
+}{files: make(map[string]parsedYAMLFile)}
+
+// loadYAMLFiles reads and parses every file, skipping the ones that cannot be read or parsed.
+// Files unchanged since they were last parsed are not parsed again.
+func loadYAMLFiles(fileNames []string) []yamlFile {
+	var files []yamlFile
+
+	for _, fileName := range fileNames {
+		info, err := os.Stat(fileName)
+		if err == nil {
+			parsedYAMLFiles.Lock()
+			parsed, ok := parsedYAMLFiles.files[fileName]
+			parsedYAMLFiles.Unlock()
+			if ok && parsed.modTime.Equal(info.ModTime()) && parsed.size == info.Size() {
+				files = append(files, yamlFile{FileName: fileName, Data: parsed.data})
+				continue
+			}
+		}
+
+		// Read the content of the file
+		fileContent, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			slog.Error("Error reading file", "file", fileName, "error", err)
+			continue
+		}
+
+		// Parse the file content to a YAML variable
+		var yamlData map[string]interface{}
+		err = yaml.Unmarshal(fileContent, &yamlData)
+		if err != nil {
+			slog.Error("Error parsing file to YAML", "file", fileName, "error", err)
+			continue
+		}
+
+		if info != nil {
+			parsedYAMLFiles.Lock()
+			parsedYAMLFiles.files[fileName] = parsedYAMLFile{modTime: info.ModTime(), size: info.Size(), data: yamlData}
+			parsedYAMLFiles.Unlock()
+		}
+		files = append(files, yamlFile{FileName: fileName, Data: yamlData})
+	}
+
+	return files
+}
+
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		runReportCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServeCommand(os.Args[2:])
+		return
+	}
+
 	// Define command-line flags
 	var configFile string
 	var scope string
+	var calendarFile string
+	var calendarWeeks int
+	var selectExpression string
+	var findingsFile string
+	var baselineFile string
+	var changedSince string
+	var blame bool
+	var notify bool
+	var tickets bool
+	var mrComment bool
+	var watch bool
+	var outputFormat string
+	var output outputOptions
 	flag.StringVar(&configFile, "config", "", "Path to the configuration file")
-	flag.StringVar(&scope, "scope", "", "blueprints, update-blueprints, all")
+	flag.StringVar(&scope, "scope", "", "blueprints, update-blueprints, blueprints-ips, update-blueprints-schedule, update-blueprints-loadbalancers, update-blueprints-scripts, blueprints-alerts, blueprints-alert-rules, blueprints-ownership, all")
+	flag.StringVar(&calendarFile, "calendar", "", "Export the update blueprints patch windows to this file (.ics or .csv)")
+	flag.IntVar(&calendarWeeks, "weeks", 4, "Number of weeks covered by the schedule checks and the calendar export, cron schedules run in the scheduleTimeZone of the configuration (UTC by default)")
+	flag.StringVar(&selectExpression, "select", "", "Selector expression for the blueprints in scope, overrides the configuration (e.g. 'maintainers contains infrastructure-caching-admins and tech_type == haproxy')")
+	flag.StringVar(&findingsFile, "json", "", "Write the findings to this JSON file, to be used as a baseline by the next runs")
+	flag.StringVar(&baselineFile, "baseline", "", "Only print the findings added and resolved since the run stored in this JSON file")
+	flag.StringVar(&changedSince, "changed-since", "", "Only check the blueprints and update blueprints changed since this git ref, and the update blueprints referencing them")
+	flag.BoolVar(&blame, "blame", false, "Add the last commit author, date and message of the file, or environment block, of every finding")
+	flag.BoolVar(&notify, "notify", false, "Post the findings, or the ones added since -baseline, to notifyWebhookURL")
+	flag.BoolVar(&tickets, "tickets", false, "Create or update a ticket per blueprint with findings in the issue tracker and close the tickets of the blueprints without findings")
+	flag.BoolVar(&mrComment, "mr-comment", false, "Post the Markdown report as a comment of the GitLab merge request of the pipeline, updated by the next pipelines")
+	flag.BoolVar(&watch, "watch", false, "Keep running and check the changed blueprints and update blueprints again when their files change, with the Azure state of the first run")
+	flag.StringVar(&outputFormat, "output", "text", "Report format: "+outputFormats())
+	output.register(flag.CommandLine)
 	flag.Parse()
 
+	if err := output.setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	if err := validateOutputFormat(outputFormat); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	// Watching checks the changed files against the findings of every file
+	if watch && changedSince != "" {
+		slog.Error("-watch can't be used with -changed-since")
+		return
+	}
+	// Tickets hold the findings of every check of a blueprint
+	if tickets && scope != "all" {
+		slog.Error("-tickets needs -scope all")
+		return
+	}
+
 	// Read configuration from the file
 	config, err := readConfig(configFile)
 	if err != nil {
-		fmt.Printf("Error reading configuration: %v\n", err)
+		slog.Error("Error reading configuration", "error", err)
+		return
+	}
+
+	// Read the baseline before running the checks
+	var baseline findingsRun
+	if baselineFile != "" {
+		baseline, err = readFindingsRun(baselineFile)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+	}
+
+	// Merge request pipelines check the files changed by the merge request
+	if mrComment && changedSince == "" {
+		changedSince = os.Getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA")
+	}
+	config.changedSince = changedSince
+
+	// Compile the blueprints selector
+	if err := applySelector(config, selectExpression); err != nil {
+		slog.Error("Error parsing selector", "error", err)
 		return
 	}
 
 	// Login to Azure CLI if needed
 	if err := azureLoginIfNeeded(config.Azure.Cloud); err != nil {
-		fmt.Printf("Error logging in to Azure CLI: %v\n", err)
+		slog.Error("Error logging in to Azure CLI", "error", err)
 		return
 	}
 
-	if scope == "update-blueprints" || scope == "all" {
-		// Get a list of YAML file names in the specified directory and its subdirectories
-		blueprintsFileNames, err := getAllYAMLFiles(config.Application.BlueprintsDirectoryPath)
-		if err != nil {
-			fmt.Printf("Error getting file names: %v\n", err)
-			return
+	// Changed files are checked again with the Azure state of the first run
+	if watch {
+		enableAzureSnapshot()
+	}
+
+	files := &repositoryFiles{config: config}
+	results, err := runChecks(files, scope, config, calendarWeeks)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	if blame {
+		gitHistory := newGitBlame()
+		for _, result := range results {
+			gitHistory.enrich(result.Findings)
 		}
+	}
 
-		updateBlueprintsFileNames, err := getAllYAMLFiles(config.Application.UpdateBlueprintsDirectoryPath)
+	// writeReport writes the report alone to stdout or -out
+	writeReport := func(run checkRun) error {
+		results := run.results
+		report, closeReport, err := output.openReport()
 		if err != nil {
-			fmt.Printf("Error getting file names: %v\n", err)
-			return
+			return err
 		}
+		switch {
+		case outputFormat != "text":
+			err = reportWriters[outputFormat](report, run, config)
+		case baselineFile != "":
+			err = printFindingsDiff(report, diffFindings(baseline.Findings, newFindingsRun(results, config, time.Now()).Findings), baseline, config)
+		default:
+			for _, result := range results {
+				if err == nil {
+					err = printCleanup(report, result, config)
+				}
+			}
+		}
+		if closeErr := closeReport(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	if err := writeReport(checkRun{results: results, files: files}); err != nil {
+		slog.Error("Error writing report", "format", outputFormat, "error", err)
+		return
+	}
 
-		checkUpdateBlueprints(blueprintsFileNames, updateBlueprintsFileNames, config)
+	run := newFindingsRun(results, config, time.Now())
+	newFindings := run.Findings
+	if baselineFile != "" {
+		newFindings = diffFindings(baseline.Findings, run.Findings).Added
 	}
 
-	if scope == "blueprints" || scope == "all" {
-		// Get a list of YAML file names in the specified directory and its subdirectories
-		blueprintsFileNames, err := getAllYAMLFiles(config.Application.BlueprintsDirectoryPath)
-		if err != nil {
-			fmt.Printf("Error getting file names: %v\n", err)
+	if findingsFile != "" {
+		if err := writeFindingsRun(findingsFile, run); err != nil {
+			slog.Error("Error writing findings", "error", err)
 			return
 		}
-
-		checkBlueprints(blueprintsFileNames, config)
+		slog.Info("Findings written", "file", findingsFile)
 	}
 
-	if scope == "blueprints-ips" || scope == "all" {
-		// Get a list of YAML file names in the specified directory and its subdirectories
-		blueprintsFileNames, err := getAllYAMLFiles(config.Application.BlueprintsDirectoryPath)
-		if err != nil {
-			fmt.Printf("Error getting file names: %v\n", err)
+	if notify {
+		if err := notifyFindings(newFindings, config); err != nil {
+			slog.Error("Error sending notification", "error", err)
 			return
 		}
-
-		checkBlueprintsIPs(blueprintsFileNames, config)
+		slog.Info("Findings notified", "findings", len(newFindings))
 	}
 
-}
+	if tickets {
+		if err := syncTickets(checkRun{results: results, files: files}, config); err != nil {
+			slog.Error("Error syncing tickets", "error", err)
+			return
+		}
+	}
 
-func checkBlueprints(fileNames []string, config *Config) {
-	// Store cleanup guidance
-	var cleanup string
-	cleanup = ""
+	if mrComment {
+		if err := commentMergeRequest(results, config); err != nil {
+			slog.Error("Error commenting merge request", "error", err)
+			return
+		}
+	}
 
-	// Loop through each file and parse to YAML
-	for _, fileName := range fileNames {
-		// Read the content of the file
-		fileContent, err := ioutil.ReadFile(fileName)
+	if calendarFile != "" {
+		updateBlueprintsFileNames, err := getAllYAMLFiles(config.Application.UpdateBlueprintsDirectoryPath, config)
 		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", fileName, err)
-			continue
+			slog.Error("Error getting file names", "error", err)
+			return
 		}
 
-		// Parse the file content to a YAML variable
-		var yamlData map[string]interface{}
-		err = yaml.Unmarshal(fileContent, &yamlData)
+		if err := exportMaintenanceCalendar(updateBlueprintsFileNames, config, calendarFile, calendarWeeks); err != nil {
+			slog.Error("Error exporting maintenance calendar", "error", err)
+			return
+		}
+		slog.Info("Maintenance calendar written", "file", calendarFile)
+	}
+
+	if watch {
+		err := watchFiles(results, scope, config, calendarWeeks, blame, func(results []checkResult) error {
+			return writeReport(checkRun{results: results, files: &repositoryFiles{config: config}})
+		})
 		if err != nil {
-			fmt.Printf("Error parsing file %s to YAML: %v\n", fileName, err)
-			continue
+			slog.Error("Error watching files", "error", err)
 		}
+	}
 
-		if listValue, ok := yamlData[config.Application.TargetKey]; ok {
-			// Check if the target value is in the list
-			if listContainsValue(listValue, config.Application.TargetValue) {
-				// Check if the key "environment_specific" exists
-				if environmentSpecific, ok := yamlData["environment_specific"]; ok {
-					// Check if it's a list
-					if environmentList, ok := environmentSpecific.([]interface{}); ok {
-						// Iterate over the elements in the list
-						for _, env := range environmentList {
-							// Check if it's a map
-							if envMap, ok := env.(map[interface{}]interface{}); ok {
+}
+
+func checkBlueprints(fileNames []string, vms *azureVMs, config *Config) []Finding {
+	// Store cleanup guidance
+	var findings []Finding
+
+	// Loop through each parsed file
+	for _, file := range loadYAMLFiles(fileNames) {
+		yamlData, fileName := file.Data, file.FileName
+
+		if isTargetBlueprint(yamlData, config) {
+			// Check if the key "environment_specific" exists
+			if environmentSpecific, ok := yamlData["environment_specific"]; ok {
+				// Check if it's a list
+				if environmentList, ok := environmentSpecific.([]interface{}); ok {
+					// Iterate over the elements in the list
+					for envIndex, env := range environmentList {
+						// Check if it's a map
+						if envMap, ok := env.(map[interface{}]interface{}); ok {
+							// Check if the key "environment" exists and has the value "dev"
+							if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
 								// Check if the key "environment" exists and has the value "dev"
-								if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
-									// Check if the key "environment" exists and has the value "dev"
-									if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
-										// Check if the key "virtual_machines" exists and is a list
-										if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
-											// Iterate over virtual machines
-											for _, vm := range vmList {
-												// Check if it's a map
-												if vmMap, ok := vm.(map[interface{}]interface{}); ok {
-													// Check if the key "name" exists
-													if vmName, ok := vmMap["name"]; ok {
-														resourceGroup := constructResourceGroupName(envMap, yamlData)
-														for i := 1; i <= vmMap["count"].(int); i++ {
-															var fullVmName string
-															if strings.EqualFold(vmMap["os"].(string), "windows") {
-																fullVmName = fmt.Sprintf("%s-%d", vmMap["name"].(string), i)
-															} else {
-																fullVmName = constructVMName(envMap, yamlData, vmName.(string), i)
-															}
+								if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
+									// Check if the key "virtual_machines" exists and is a list
+									if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
+										// Iterate over virtual machines
+										for vmIndex, vm := range vmList {
+											// Check if it's a map
+											if vmMap, ok := vm.(map[interface{}]interface{}); ok {
+												// Check if the key "name" exists
+												if vmName, ok := vmMap["name"].(string); ok {
+													count, countOK := vmMap["count"].(int)
+													vmOS, osOK := vmMap["os"].(string)
+													if !countOK || !osOK {
+														slog.Info("VM group has an invalid count or os", "blueprint", blueprintPBN(yamlData), "vm_group", vmName, "count", vmMap["count"], "os", vmMap["os"])
+														findings = append(findings, newFinding("blueprints", severityError, yamlData, fileName, fmt.Sprintf("VM group %s has an invalid count or os, its VMs can't be checked. Check blueprint %s in file %s", vmName, blueprintPBN(yamlData), fileName)).inEnvironment(config.Application.Dc, config.Application.Env).at("environment_specific", envIndex, "virtual_machines", vmIndex))
+														continue
+													}
 
-															// Add the VM name to the slice
-															fmt.Printf("File %s contains VM name: %v\n", fileName, fullVmName)
-
-															exists, err := checkAzureVMExists(config.Azure.Subscription, resourceGroup, fullVmName)
-															if err != nil {
-																fmt.Printf("Resource Group %s not found. Check for cleanup blueprint %s-%s-%s\n%s\n", resourceGroup, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), err)
-																cleanup += fmt.Sprintf("Resource Group %s not found while looking for VM %s. Check for cleanup blueprint %s-%s-%s in file %s\n", resourceGroup, fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)
-															} else if exists {
-																fmt.Printf("Virtual machine %s exists in Azure.\n", fullVmName)
-															} else {
-																fmt.Printf("Virtual machine %s does not exist in Azure.\n", fullVmName)
-																cleanup += fmt.Sprintf("Resource Group exists but VM %s doesn't. Check for cleanup RG and blueprint %s-%s-%s in %s\n", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)
-															}
+													resourceGroup := constructResourceGroupName(envMap, yamlData)
+													for i := 1; i <= count; i++ {
+														var fullVmName string
+														if strings.EqualFold(vmOS, "windows") {
+															fullVmName = fmt.Sprintf("%s-%d", vmName, i)
+														} else {
+															fullVmName = constructVMName(envMap, yamlData, vmName, i)
+														}
+
+														// Add the VM name to the slice
+														slog.Debug("File contains VM name", "file", fileName, "vm", fullVmName)
+
+														azure, err := vms.get(resourceGroup, fullVmName)
+														if err != nil {
+															slog.Info("Resource Group not found", "resource_group", resourceGroup, "blueprint", blueprintPBN(yamlData), "error", err)
+															findings = append(findings, newFinding("blueprints", severityError, yamlData, fileName, fmt.Sprintf("Resource Group %s not found while looking for VM %s. Check for cleanup blueprint %s-%s-%s in file %s", resourceGroup, fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)).inEnvironment(config.Application.Dc, config.Application.Env).forVM(fullVmName).at("environment_specific", envIndex, "virtual_machines", vmIndex))
+														} else if azure != nil {
+															slog.Debug("Virtual machine exists in Azure", "vm", fullVmName)
+														} else {
+															slog.Info("Virtual machine does not exist in Azure", "vm", fullVmName)
+															findings = append(findings, newFinding("blueprints", severityError, yamlData, fileName, fmt.Sprintf("Resource Group exists but VM %s doesn't. Check for cleanup RG and blueprint %s-%s-%s in %s", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)).inEnvironment(config.Application.Dc, config.Application.Env).forVM(fullVmName).at("environment_specific", envIndex, "virtual_machines", vmIndex))
 														}
 													}
 												}
@@ -204,106 +443,99 @@ func checkBlueprints(fileNames []string, config *Config) {
 		}
 	}
 
-	if cleanup != "" {
-		fmt.Printf("\n\n#############################\n# Cleanup suggestions %s-%s\n# Blueprints\n#############################\n%s\n#############################\n", config.Application.Dc, config.Application.Env, cleanup)
-	} else {
-		fmt.Printf("\n\n#############################\n# Everything looks clean\n# Blueprints\n#############################\n")
-	}
+	return findings
 
 }
 
-func checkBlueprintsIPs(fileNames []string, config *Config) {
+func checkBlueprintsIPs(fileNames []string, vms *azureVMs, config *Config) []Finding {
 	// Store cleanup guidance
-	var cleanup string
-	cleanup = ""
-
-	// Loop through each file and parse to YAML
-	for _, fileName := range fileNames {
-		// Read the content of the file
-		fileContent, err := ioutil.ReadFile(fileName)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", fileName, err)
-			continue
-		}
-
-		// Parse the file content to a YAML variable
-		var yamlData map[string]interface{}
-		err = yaml.Unmarshal(fileContent, &yamlData)
-		if err != nil {
-			fmt.Printf("Error parsing file %s to YAML: %v\n", fileName, err)
-			continue
-		}
-
-		if listValue, ok := yamlData[config.Application.TargetKey]; ok {
-			// Check if the target value is in the list
-			if listContainsValue(listValue, config.Application.TargetValue) {
-				// Check if the key "environment_specific" exists
-				if environmentSpecific, ok := yamlData["environment_specific"]; ok {
-					// Check if it's a list
-					if environmentList, ok := environmentSpecific.([]interface{}); ok {
-						// Iterate over the elements in the list
-						for _, env := range environmentList {
-							// Check if it's a map
-							if envMap, ok := env.(map[interface{}]interface{}); ok {
+	var findings []Finding
+
+	// Loop through each parsed file
+	for _, file := range loadYAMLFiles(fileNames) {
+		yamlData, fileName := file.Data, file.FileName
+
+		if isTargetBlueprint(yamlData, config) {
+			// Check if the key "environment_specific" exists
+			if environmentSpecific, ok := yamlData["environment_specific"]; ok {
+				// Check if it's a list
+				if environmentList, ok := environmentSpecific.([]interface{}); ok {
+					// Iterate over the elements in the list
+					for envIndex, env := range environmentList {
+						// Check if it's a map
+						if envMap, ok := env.(map[interface{}]interface{}); ok {
+							// Check if the key "environment" exists and has the value "dev"
+							if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
 								// Check if the key "environment" exists and has the value "dev"
-								if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
-									// Check if the key "environment" exists and has the value "dev"
-									if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
-										// Check if the key "virtual_machines" exists and is a list
-										if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
-											// Iterate over virtual machines
-											for _, vm := range vmList {
-												// Check if it's a map
-												if vmMap, ok := vm.(map[interface{}]interface{}); ok {
-													// Check if the key "name" exists
-													if vmName, ok := vmMap["name"]; ok {
-														// Iterate over VM networks
-														if vmNetworkList, ok := vmMap["networks"].([]interface{}); ok {
-															for _, vmNetwork := range vmNetworkList {
-																if vmNetworkMap, ok := vmNetwork.(map[interface{}]interface{}); ok {
-																	if vmAddresses, ok := vmNetworkMap["address"].([]interface{}); ok {
-																		//Check if number of IPs is the same as count
-																		if len(vmAddresses) == vmMap["count"] {
-																			fmt.Printf("Number of IP adresses and count match for %s-%s-%s-%s-%s\n", envMap["datacenter"].(string), envMap["environment"].(string), yamlData["platform"].(string), yamlData["boundary"].(string), vmMap["name"].(string))
-
-																			resourceGroup := constructResourceGroupName(envMap, yamlData)
-																			var ip_list []string
-																			var ip_errors bool = false
-																			//Check each IP
-																			for i, vmIP := range vmAddresses {
-																				var fullVmName string
-																				if strings.EqualFold(vmMap["os"].(string), "windows") {
-																					fullVmName = fmt.Sprintf("%s-%d", vmMap["name"].(string), i+1)
-																				} else {
-																					fullVmName = constructVMName(envMap, yamlData, vmName.(string), i+1)
-																				}
-																				ipCheck, azIP, err := checkAzureVMIP(config.Azure.Subscription, resourceGroup, fullVmName, vmIP.(string))
-																				if azIP != "" {
-																					ip_list = append(ip_list, azIP)
-																				}
-																				if err != nil {
-																					fmt.Printf("IP for vm %s could not be checked. Check for cleanup blueprint %s-%s-%s\n", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string))
-																					cleanup += fmt.Sprintf("IP for vm %s could not be checked. Check for cleanup blueprint %s-%s-%s in file %s\n", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)
-																				} else if ipCheck {
-																					fmt.Printf("Virtual machine %s has correct IP in Blueprint.\n", fullVmName)
-																				} else {
-																					fmt.Printf("IP for vm %s does not match. Check for cleanup blueprint %s-%s-%s\n", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string))
-																					cleanup += fmt.Sprintf("IP for vm %s does not match. Check for cleanup blueprint %s-%s-%s in file %s\n", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)
-																					ip_errors = true
-																				}
+								if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
+									// Check if the key "virtual_machines" exists and is a list
+									if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
+										// Iterate over virtual machines
+										for vmIndex, vm := range vmList {
+											// Check if it's a map
+											if vmMap, ok := vm.(map[interface{}]interface{}); ok {
+												// Check if the key "name" exists
+												if vmName, ok := vmMap["name"].(string); ok {
+													vmOS, ok := vmMap["os"].(string)
+													if !ok {
+														slog.Warn("IPs could not be checked, the VM group has an invalid os", "blueprint", blueprintPBN(yamlData), "vm_group", vmName, "os", vmMap["os"])
+														findings = append(findings, newFinding("blueprints-ips", severityWarning, yamlData, fileName, fmt.Sprintf("IPs of VM group %s could not be checked, its os is invalid. Check blueprint %s in file %s", vmName, blueprintPBN(yamlData), fileName)).inEnvironment(config.Application.Dc, config.Application.Env).at("environment_specific", envIndex, "virtual_machines", vmIndex))
+														continue
+													}
+
+													// Iterate over VM networks
+													if vmNetworkList, ok := vmMap["networks"].([]interface{}); ok {
+														for networkIndex, vmNetwork := range vmNetworkList {
+															if vmNetworkMap, ok := vmNetwork.(map[interface{}]interface{}); ok {
+																if vmAddresses, ok := vmNetworkMap["address"].([]interface{}); ok {
+																	//Check if number of IPs is the same as count
+																	if len(vmAddresses) == vmMap["count"] {
+																		slog.Debug("Number of IP adresses and count match", "blueprint", blueprintPBN(yamlData), "dc", envMap["datacenter"], "env", envMap["environment"], "vm_group", vmMap["name"])
+
+																		resourceGroup := constructResourceGroupName(envMap, yamlData)
+																		var ip_list []string
+																		var ip_errors bool = false
+																		//Check each IP
+																		for i, vmIP := range vmAddresses {
+																			var fullVmName string
+																			if strings.EqualFold(vmOS, "windows") {
+																				fullVmName = fmt.Sprintf("%s-%d", vmName, i+1)
+																			} else {
+																				fullVmName = constructVMName(envMap, yamlData, vmName, i+1)
+																			}
+																			azure, err := vms.get(resourceGroup, fullVmName)
+																			if err == nil && azure == nil {
+																				err = fmt.Errorf("VM %s not found", fullVmName)
+																			}
+																			var azIP string
+																			if err == nil {
+																				azIP = azure.PrivateIps
+																			}
+																			if azIP != "" {
+																				ip_list = append(ip_list, azIP)
+																			}
+																			if err != nil {
+																				slog.Warn("IP could not be checked", "vm", fullVmName, "blueprint", blueprintPBN(yamlData), "error", err)
+																				findings = append(findings, newFinding("blueprints-ips", severityWarning, yamlData, fileName, fmt.Sprintf("IP for vm %s could not be checked. Check for cleanup blueprint %s-%s-%s in file %s", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)).inEnvironment(config.Application.Dc, config.Application.Env).forVM(fullVmName).at("environment_specific", envIndex, "virtual_machines", vmIndex, "networks", networkIndex, "address", i))
+																			} else if strings.Contains(azIP, vmIP.(string)) {
+																				slog.Debug("Virtual machine has correct IP in Blueprint", "vm", fullVmName)
+																			} else {
+																				slog.Info("IP does not match", "vm", fullVmName, "blueprint", blueprintPBN(yamlData), "ip", vmIP, "azure_ips", strings.TrimSpace(azIP))
+																				findings = append(findings, newFinding("blueprints-ips", severityError, yamlData, fileName, fmt.Sprintf("IP for vm %s does not match. Check for cleanup blueprint %s-%s-%s in file %s", fullVmName, yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), fileName)).inEnvironment(config.Application.Dc, config.Application.Env).forVM(fullVmName).at("environment_specific", envIndex, "virtual_machines", vmIndex, "networks", networkIndex, "address", i))
+																				ip_errors = true
 																			}
-																			if len(ip_list) > 0 && ip_errors {
-																				fmt.Printf("Correct IP order for blueprint %s-%s-%s in the dc-env %s-%s is:\n", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), envMap["datacenter"].(string), envMap["environment"].(string))
-																				cleanup += fmt.Sprintf("Correct IP order for blueprint %s-%s-%s in the dc-env %s-%s is:\n", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), envMap["datacenter"].(string), envMap["environment"].(string))
-																				for _, ip := range ip_list {
-																					fmt.Printf("- %s", ip)
-																					cleanup += fmt.Sprintf("- %s", ip)
-																				}
+																		}
+																		if len(ip_list) > 0 && ip_errors {
+																			ipOrder := fmt.Sprintf("Correct IP order for blueprint %s-%s-%s in the dc-env %s-%s is:", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), envMap["datacenter"].(string), envMap["environment"].(string))
+																			for _, ip := range ip_list {
+																				ipOrder += fmt.Sprintf("\n- %s", strings.TrimSpace(ip))
 																			}
-																		} else {
-																			fmt.Printf("Number of IP adresses and count do not match for %s-%s-%s-%s-%s\n", envMap["datacenter"].(string), envMap["environment"].(string), yamlData["platform"].(string), yamlData["boundary"].(string), vmMap["name"].(string))
-																			cleanup += fmt.Sprintf("Number of IP adresses and count do not match for %s-%s-%s-%s-%s\n", envMap["datacenter"].(string), envMap["environment"].(string), yamlData["platform"].(string), yamlData["boundary"].(string), vmMap["name"].(string))
+																			slog.Info(ipOrder)
+																			findings = append(findings, newFinding("blueprints-ips", severityInfo, yamlData, fileName, ipOrder).inEnvironment(config.Application.Dc, config.Application.Env).at("environment_specific", envIndex, "virtual_machines", vmIndex, "networks", networkIndex, "address"))
 																		}
+																	} else {
+																		slog.Info("Number of IP adresses and count do not match", "blueprint", blueprintPBN(yamlData), "dc", envMap["datacenter"], "env", envMap["environment"], "vm_group", vmMap["name"])
+																		findings = append(findings, newFinding("blueprints-ips", severityWarning, yamlData, fileName, fmt.Sprintf("Number of IP adresses and count do not match for %s-%s-%s-%s-%s", envMap["datacenter"].(string), envMap["environment"].(string), yamlData["platform"].(string), yamlData["boundary"].(string), vmMap["name"].(string))).inEnvironment(config.Application.Dc, config.Application.Env).at("environment_specific", envIndex, "virtual_machines", vmIndex, "networks", networkIndex, "address"))
 																	}
 																}
 															}
@@ -322,99 +554,58 @@ func checkBlueprintsIPs(fileNames []string, config *Config) {
 		}
 	}
 
-	if cleanup != "" {
-		fmt.Printf("\n\n#############################\n# Cleanup suggestions %s-%s\n# Blueprint IPs\n#############################\n%s\n#############################\n", config.Application.Dc, config.Application.Env, cleanup)
-	} else {
-		fmt.Printf("\n\n#############################\n# Everything looks clean\n# Blueprint Ips\n#############################\n")
-	}
+	return findings
 
 }
 
-func checkUpdateBlueprints(blueprintsFileNames []string, updateBlueprintsFileNames []string, config *Config) {
+func checkUpdateBlueprints(blueprintsFileNames []string, updateBlueprintsFileNames []string, config *Config) []Finding {
 	// Store Blueprints YAML data in a slice
 	var blueprintsAllYAMLData []map[string]interface{}
 
-	// Loop through each file and parse to YAML
-	for _, fileName := range blueprintsFileNames {
-		// Read the content of the file
-		fileContent, err := ioutil.ReadFile(fileName)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", fileName, err)
-			continue
-		}
-
-		// Parse the file content to a YAML variable
-		var yamlData map[string]interface{}
-		err = yaml.Unmarshal(fileContent, &yamlData)
-		if err != nil {
-			fmt.Printf("Error parsing file %s to YAML: %v\n", fileName, err)
-			continue
-		}
+	// Loop through each parsed file
+	for _, file := range loadYAMLFiles(blueprintsFileNames) {
+		yamlData := file.Data
 
 		// Add YAML data to the slice
 		blueprintsAllYAMLData = append(blueprintsAllYAMLData, yamlData)
 	}
 
 	// Store Update Blueprints YAML data in a slice
-	var updateBlueprintsAllYAMLData []map[string]interface{}
-
-	// Loop through each file and parse to YAML
-	for _, fileName := range updateBlueprintsFileNames {
-		// Read the content of the file
-		fileContent, err := ioutil.ReadFile(fileName)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", fileName, err)
-			continue
-		}
-
-		// Parse the file content to a YAML variable
-		var yamlData map[string]interface{}
-		err = yaml.Unmarshal(fileContent, &yamlData)
-		if err != nil {
-			fmt.Printf("Error parsing file %s to YAML: %v\n", fileName, err)
-			continue
-		}
-
-		// Add YAML data to the slice
-		updateBlueprintsAllYAMLData = append(updateBlueprintsAllYAMLData, yamlData)
-	}
+	updateBlueprintsAllYAMLData := loadYAMLFiles(updateBlueprintsFileNames)
 
 	// Store cleanup guidance
-	var cleanup string
-	cleanup = ""
+	var findings []Finding
 
 	// Iterate over the YAML data and check if the target value is in the list
-	for _, yamlData := range updateBlueprintsAllYAMLData {
-		if listValue, ok := yamlData[config.Application.TargetKey]; ok {
-			// Check if the target value is in the list
-			if listContainsValue(listValue, config.Application.TargetValue) {
-				// Check if the key "environment_specific" exists
-				if environmentSpecific, ok := yamlData["environment_specific"]; ok {
-					// Check if it's a list
-					if environmentList, ok := environmentSpecific.([]interface{}); ok {
-						// Iterate over the elements in the list
-						for _, env := range environmentList {
-							// Check if it's a map
-							if envMap, ok := env.(map[interface{}]interface{}); ok {
+	for _, file := range updateBlueprintsAllYAMLData {
+		yamlData, fileName := file.Data, file.FileName
+		if isTargetBlueprint(yamlData, config) {
+			// Check if the key "environment_specific" exists
+			if environmentSpecific, ok := yamlData["environment_specific"]; ok {
+				// Check if it's a list
+				if environmentList, ok := environmentSpecific.([]interface{}); ok {
+					// Iterate over the elements in the list
+					for envIndex, env := range environmentList {
+						// Check if it's a map
+						if envMap, ok := env.(map[interface{}]interface{}); ok {
+							// Check if the key "environment" exists and has the value "dev"
+							if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
 								// Check if the key "environment" exists and has the value "dev"
-								if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
-									// Check if the key "environment" exists and has the value "dev"
-									if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
-										// Check if the key "virtual_machines" exists and is a list
-										if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
-											// Iterate over virtual machines
-											for _, vm := range vmList {
-												// Check if it's a map
-												if vmMap, ok := vm.(map[interface{}]interface{}); ok {
-													// Check if the key "infrastructure_blueprint" exists
-													if envValue, ok := vmMap["infrastructure_blueprint"]; ok {
-														exists, _ := checkBlueprintFromUpdateBlueprint(envValue.(string), config, blueprintsAllYAMLData)
-														if exists {
-															fmt.Printf("Update blueprint %s-%s-%s-%s-%s has a matching blueprint.\n", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), config.Application.Dc, config.Application.Env)
-														} else {
-															fmt.Printf("Update blueprint %s-%s-%s-%s-%s does not have a matching blueprint.\n", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), config.Application.Dc, config.Application.Env)
-															cleanup += fmt.Sprintf("Update blueprint %s-%s-%s-%s-%s does not have a matching blueprint.\n", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), config.Application.Dc, config.Application.Env)
-														}
+								if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
+									// Check if the key "virtual_machines" exists and is a list
+									if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
+										// Iterate over virtual machines
+										for vmIndex, vm := range vmList {
+											// Check if it's a map
+											if vmMap, ok := vm.(map[interface{}]interface{}); ok {
+												// Check if the key "infrastructure_blueprint" exists
+												if envValue, ok := vmMap["infrastructure_blueprint"]; ok {
+													exists, _ := checkBlueprintFromUpdateBlueprint(envValue.(string), config, blueprintsAllYAMLData)
+													if exists {
+														slog.Debug("Update blueprint has a matching blueprint", "update_blueprint", blueprintPBN(yamlData), "dc", config.Application.Dc, "env", config.Application.Env)
+													} else {
+														slog.Info("Update blueprint does not have a matching blueprint", "update_blueprint", blueprintPBN(yamlData), "dc", config.Application.Dc, "env", config.Application.Env)
+														findings = append(findings, newFinding("update-blueprints", severityError, yamlData, fileName, fmt.Sprintf("Update blueprint %s-%s-%s-%s-%s does not have a matching blueprint.", yamlData["platform"].(string), yamlData["boundary"].(string), yamlData["name"].(string), config.Application.Dc, config.Application.Env)).inEnvironment(config.Application.Dc, config.Application.Env).at("environment_specific", envIndex, "virtual_machines", vmIndex, "infrastructure_blueprint"))
 													}
 												}
 											}
@@ -428,11 +619,7 @@ func checkUpdateBlueprints(blueprintsFileNames []string, updateBlueprintsFileNam
 			}
 		}
 	}
-	if cleanup != "" {
-		fmt.Printf("\n\n#############################\n# Cleanup suggestions %s-%s\n# Update Blueprints\n#############################\n%s\n#############################\n", config.Application.Dc, config.Application.Env, cleanup)
-	} else {
-		fmt.Printf("\n\n#############################\n# Everything looks clean\n# Update Blueprints\n#############################\n")
-	}
+	return findings
 }
 
 func checkBlueprintFromUpdateBlueprint(blueprintPBN string, config *Config, blueprintsAllYAMLData []map[string]interface{}) (bool, error) {
@@ -444,23 +631,20 @@ func checkBlueprintFromUpdateBlueprint(blueprintPBN string, config *Config, blue
 				if name, ok := yamlData["name"].(string); ok {
 					pbn := fmt.Sprintf("%s-%s-%s", platform, boundary, name)
 					if strings.EqualFold(pbn, blueprintPBN) {
-						if listValue, ok := yamlData[config.Application.TargetKey]; ok {
-							// Check if the target value is in the list
-							if listContainsValue(listValue, config.Application.TargetValue) {
-								// Check if the key "environment_specific" exists
-								if environmentSpecific, ok := yamlData["environment_specific"]; ok {
-									// Check if it's a list
-									if environmentList, ok := environmentSpecific.([]interface{}); ok {
-										// Iterate over the elements in the list
-										for _, env := range environmentList {
-											// Check if it's a map
-											if envMap, ok := env.(map[interface{}]interface{}); ok {
+						if isTargetBlueprint(yamlData, config) {
+							// Check if the key "environment_specific" exists
+							if environmentSpecific, ok := yamlData["environment_specific"]; ok {
+								// Check if it's a list
+								if environmentList, ok := environmentSpecific.([]interface{}); ok {
+									// Iterate over the elements in the list
+									for _, env := range environmentList {
+										// Check if it's a map
+										if envMap, ok := env.(map[interface{}]interface{}); ok {
+											// Check if the key "environment" exists and has the value "dev"
+											if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
 												// Check if the key "environment" exists and has the value "dev"
-												if envValue, ok := envMap["environment"]; ok && envValue == config.Application.Env {
-													// Check if the key "environment" exists and has the value "dev"
-													if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
-														return true, nil
-													}
+												if envValue, ok := envMap["datacenter"]; ok && envValue == config.Application.Dc {
+													return true, nil
 												}
 											}
 										}
@@ -477,6 +661,15 @@ func checkBlueprintFromUpdateBlueprint(blueprintPBN string, config *Config, blue
 
 }
 
+// blueprintPBN returns the platform-boundary-name identifier of a blueprint or update blueprint
+func blueprintPBN(yamlData map[string]interface{}) string {
+	platform, _ := yamlData["platform"].(string)
+	boundary, _ := yamlData["boundary"].(string)
+	name, _ := yamlData["name"].(string)
+
+	return fmt.Sprintf("%s-%s-%s", platform, boundary, name)
+}
+
 func constructResourceGroupName(envMap map[interface{}]interface{}, yamlData map[string]interface{}) string {
 	environment, _ := envMap["environment"].(string)
 	datacenter, _ := envMap["datacenter"].(string)
@@ -521,9 +714,81 @@ func readConfig(configFile string) (*Config, error) {
 		return nil, fmt.Errorf("error parsing config file: %v", err)
 	}
 
+	// Cron schedules run in UTC without a time zone
+	config.scheduleLocation, err = time.LoadLocation(config.Application.ScheduleTimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("error loading scheduleTimeZone: %v", err)
+	}
+
 	return &config, nil
 }
 
+// environmentEntries returns the environment_specific entries of a blueprint or update blueprint
+func environmentEntries(yamlData map[string]interface{}) []map[interface{}]interface{} {
+	var entries []map[interface{}]interface{}
+
+	if environmentList, ok := yamlData["environment_specific"].([]interface{}); ok {
+		for _, env := range environmentList {
+			if envMap, ok := env.(map[interface{}]interface{}); ok {
+				entries = append(entries, envMap)
+			}
+		}
+	}
+
+	return entries
+}
+
+// deployedIn checks if a blueprint or update blueprint has an environment_specific entry for the configured dc-env
+func deployedIn(yamlData map[string]interface{}, config *Config) bool {
+	for _, envMap := range environmentEntries(yamlData) {
+		if envMap["environment"] == config.Application.Env && envMap["datacenter"] == config.Application.Dc {
+			return true
+		}
+	}
+	return false
+}
+
+// applySelector compiles the selector expression, the one given overrides the configured one
+func applySelector(config *Config, expression string) error {
+	if expression != "" {
+		config.Application.Select = expression
+	}
+
+	compiled, err := parseSelector(config.Application.Select)
+	if err != nil {
+		return err
+	}
+	config.selector = compiled
+
+	return nil
+}
+
+// isTargetBlueprint checks if the blueprint matches the selector or has the configured target value in its target key list.
+// Every blueprint is a target of the reports covering all teams.
+func isTargetBlueprint(yamlData map[string]interface{}, config *Config) bool {
+	if config.allTeams {
+		return true
+	}
+	if config.selector != nil {
+		return config.selector.matches(yamlData)
+	}
+	listValue, ok := yamlData[config.Application.TargetKey]
+	return ok && listContainsValue(listValue, config.Application.TargetValue)
+}
+
+// targetFiles keeps only the files of target blueprints
+func targetFiles(files []yamlFile, config *Config) []yamlFile {
+	var targets []yamlFile
+
+	for _, file := range files {
+		if isTargetBlueprint(file.Data, config) {
+			targets = append(targets, file)
+		}
+	}
+
+	return targets
+}
+
 // listContainsValue checks if a value exists in a list (slice)
 func listContainsValue(listValue interface{}, targetValue string) bool {
 	switch v := listValue.(type) {
@@ -539,57 +804,36 @@ func listContainsValue(listValue interface{}, targetValue string) bool {
 	return false
 }
 
-// checkAzureVMExists checks if a virtual machine with the given name exists in Azure using Azure CLI
-func checkAzureVMExists(subscription, resourceGroup, vmName string) (bool, error) {
-	// Use Azure CLI to check VM existence with specified resource group
-	cmd := exec.Command("az", "vm", "show", "--name", vmName, "--resource-group", resourceGroup, "--subscription", subscription)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Check if the VM not found error occurred
-		if strings.Contains(string(output), "ResourceNotFound") {
-			return false, nil
-		}
-		return false, fmt.Errorf("error executing Azure CLI command: %v\nOutput: %s", err, output)
+// azureCLI runs an Azure CLI command and records its duration for the metrics, the vm queries are answered from the snapshot while watching
+func azureCLI(args ...string) ([]byte, error) {
+	if entry, ok := azureSnapshotLookup(args); ok {
+		return entry.output, entry.err
 	}
 
-	return true, nil
-}
-
-// checkAzureVMExists checks if a virtual machine with the given name exists in Azure using Azure CLI
-func checkAzureVMIP(subscription, resourceGroup, vmName string, ip string) (bool, string, error) {
-	// Use Azure CLI to check VM existence with specified resource group
-	cmd := exec.Command("az", "vm", "show", "--name", vmName, "--resource-group", resourceGroup, "--subscription", subscription, "-d", "--query", "\"privateIps\"", "--out", "tsv")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return false, "", fmt.Errorf("error executing Azure CLI command: %v\nOutput: %s", err, output)
-	}
-
-	if strings.Contains(string(output), ip) {
-		return true, string(output), nil
-	}
-	return false, string(output), nil
+	started := time.Now()
+	output, err := exec.Command("az", args...).CombinedOutput()
+	azureCallDurations.WithLabelValues(azureCommandName(args)).Observe(time.Since(started).Seconds())
+	azureSnapshotStore(args, output, err)
+	return output, err
 }
 
 // azureLoginIfNeeded logs in to Azure CLI if not already logged in
 func azureLoginIfNeeded(azureCloud string) error {
 	// Azure CLI set cloud
-	setCloudCmd := exec.Command("az", "cloud", "set", "--name", azureCloud)
-	setCloudOutput, setCloudErr := setCloudCmd.CombinedOutput()
+	setCloudOutput, setCloudErr := azureCLI("cloud", "set", "--name", azureCloud)
 	if setCloudErr != nil {
 		return fmt.Errorf("error executing Azure CLI cloud set command: %v\nOutput: %s", setCloudErr, setCloudOutput)
 	}
 
 	// Check if Azure CLI is already logged in
-	cmd := exec.Command("az", "account", "show")
-	_, err := cmd.CombinedOutput()
+	_, err := azureCLI("account", "show")
 	if err == nil {
 		// Azure CLI is already logged in
 		return nil
 	}
 
 	// Azure CLI is not logged in, perform login
-	loginCmd := exec.Command("az", "login")
-	loginOutput, loginErr := loginCmd.CombinedOutput()
+	loginOutput, loginErr := azureCLI("login")
 	if loginErr != nil {
 		return fmt.Errorf("error executing Azure CLI login command: %v\nOutput: %s", loginErr, loginOutput)
 	}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// mergeRequest is a GitLab merge request, read from the variables of a merge request pipeline
+type mergeRequest struct {
+	apiURL    string
+	projectID string
+	iid       string
+	// token comes from BPCLEANER_GITLAB_TOKEN or GITLAB_TOKEN
+	token  string
+	client *http.Client
+}
+
+// mergeRequestNote is a comment of a merge request
+type mergeRequestNote struct {
+	ID   int    `json:"id"`
+	Body string `json:"body"`
+}
+
+// newMergeRequest reads the merge request of the pipeline from the GitLab CI variables
+func newMergeRequest() (*mergeRequest, error) {
+	mr := &mergeRequest{
+		apiURL:    strings.TrimSuffix(os.Getenv("CI_API_V4_URL"), "/"),
+		projectID: os.Getenv("CI_PROJECT_ID"),
+		iid:       os.Getenv("CI_MERGE_REQUEST_IID"),
+		token:     os.Getenv("BPCLEANER_GITLAB_TOKEN"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if mr.token == "" {
+		mr.token = os.Getenv("GITLAB_TOKEN")
+	}
+
+	if mr.apiURL == "" || mr.projectID == "" || mr.iid == "" {
+		return nil, fmt.Errorf("CI_API_V4_URL, CI_PROJECT_ID and CI_MERGE_REQUEST_IID not set, not in a merge request pipeline")
+	}
+	if mr.token == "" {
+		return nil, fmt.Errorf("BPCLEANER_GITLAB_TOKEN or GITLAB_TOKEN not set")
+	}
+
+	return mr, nil
+}
+
+// notesPath is the API path of the notes of the merge request
+func (mr *mergeRequest) notesPath() string {
+	return fmt.Sprintf("/projects/%s/merge_requests/%s/notes", url.PathEscape(mr.projectID), url.PathEscape(mr.iid))
+}
+
+// do calls the GitLab API with a JSON body and decodes the JSON response into out when not nil, returning the response headers
+func (mr *mergeRequest) do(method string, path string, body interface{}, out interface{}) (http.Header, error) {
+	var requestBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		requestBody = bytes.NewReader(content)
+	}
+
+	request, err := http.NewRequest(method, mr.apiURL+path, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("PRIVATE-TOKEN", mr.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := mr.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error calling GitLab: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("error calling GitLab %s %s: %s: %s", method, path, response.Status, strings.TrimSpace(string(message)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("error parsing GitLab response to %s %s: %v", method, path, err)
+		}
+	}
+
+	return response.Header, nil
+}
+
+// findNote returns the first note of the merge request starting with the marker, nil without one
+func (mr *mergeRequest) findNote(marker string) (*mergeRequestNote, error) {
+	page := "1"
+	for page != "" {
+		var notes []mergeRequestNote
+		header, err := mr.do(http.MethodGet, mr.notesPath()+"?per_page=100&sort=asc&page="+url.QueryEscape(page), nil, &notes)
+		if err != nil {
+			return nil, err
+		}
+		for i := range notes {
+			if strings.HasPrefix(notes[i].Body, marker) {
+				return &notes[i], nil
+			}
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return nil, nil
+}
+
+// mergeRequestCommentMarker identifies the comment of a dc-env, so every pipeline job updates its own comment
+func mergeRequestCommentMarker(config *Config) string {
+	return fmt.Sprintf("<!-- bpcleaner %s-%s -->", config.Application.Dc, config.Application.Env)
+}
+
+// commentMergeRequest posts the Markdown report as a comment of the merge request, or updates the comment of a previous pipeline
+func commentMergeRequest(results []checkResult, config *Config) error {
+	mr, err := newMergeRequest()
+	if err != nil {
+		return err
+	}
+
+	// Link the findings to the files of the pipeline commit
+	linkBaseURL := config.Application.ReportLinkBaseURL
+	if linkBaseURL == "" && os.Getenv("CI_PROJECT_URL") != "" && os.Getenv("CI_COMMIT_SHA") != "" {
+		linkBaseURL = fmt.Sprintf("%s/-/blob/%s/", strings.TrimSuffix(os.Getenv("CI_PROJECT_URL"), "/"), os.Getenv("CI_COMMIT_SHA"))
+	}
+
+	marker := mergeRequestCommentMarker(config)
+	var b strings.Builder
+	b.WriteString(marker + "\n")
+	if err := writeMarkdownDocument(&b, newDocumentReport(results, config, linkBaseURL)); err != nil {
+		return err
+	}
+	body := map[string]string{"body": b.String()}
+
+	note, err := mr.findNote(marker)
+	if err != nil {
+		return err
+	}
+	if note == nil {
+		var created mergeRequestNote
+		if _, err := mr.do(http.MethodPost, mr.notesPath(), body, &created); err != nil {
+			return err
+		}
+		slog.Info("Merge request comment created", "merge_request", mr.iid, "note", created.ID)
+		return nil
+	}
+
+	if _, err := mr.do(http.MethodPut, fmt.Sprintf("%s/%d", mr.notesPath(), note.ID), body, nil); err != nil {
+		return err
+	}
+	slog.Info("Merge request comment updated", "merge_request", mr.iid, "note", note.ID)
+
+	return nil
+}
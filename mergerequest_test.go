@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGitLab is a GitLab API with the notes of merge request 7 of project 42, recording the calls of bpcleaner
+type fakeGitLab struct {
+	t        *testing.T
+	mu       sync.Mutex
+	notes    []mergeRequestNote
+	pageSize int
+	pages    []string
+	created  []string
+	updated  map[int]string
+}
+
+func (g *fakeGitLab) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+		http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	const notesPath = "/api/v4/projects/42/merge_requests/7/notes"
+	var body map[string]string
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == notesPath:
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		g.pages = append(g.pages, r.URL.Query().Get("page"))
+		start := (page - 1) * g.pageSize
+		end := start + g.pageSize
+		if end < len(g.notes) {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		} else {
+			end = len(g.notes)
+		}
+		writeJSON(w, http.StatusOK, g.notes[start:end])
+	case r.Method == http.MethodPost && r.URL.Path == notesPath:
+		g.created = append(g.created, body["body"])
+		writeJSON(w, http.StatusCreated, mergeRequestNote{ID: 100 + len(g.created), Body: body["body"]})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, notesPath+"/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, notesPath+"/"))
+		g.updated[id] = body["body"]
+		writeJSON(w, http.StatusOK, mergeRequestNote{ID: id, Body: body["body"]})
+	default:
+		g.t.Errorf("unexpected call %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+// setupMergeRequestTest starts a fake GitLab with the notes and sets the variables of a merge request pipeline
+func setupMergeRequestTest(t *testing.T, notes ...mergeRequestNote) (*fakeGitLab, *Config, []checkResult) {
+	t.Helper()
+
+	gitlab := &fakeGitLab{t: t, notes: notes, pageSize: 2, updated: make(map[int]string)}
+	server := httptest.NewServer(gitlab)
+	t.Cleanup(server.Close)
+
+	t.Setenv("CI_API_V4_URL", server.URL+"/api/v4/")
+	t.Setenv("CI_PROJECT_ID", "42")
+	t.Setenv("CI_MERGE_REQUEST_IID", "7")
+	t.Setenv("CI_PROJECT_URL", "https://gitlab.example.com/platform/blueprints/")
+	t.Setenv("CI_COMMIT_SHA", "0123abcd")
+	t.Setenv("BPCLEANER_GITLAB_TOKEN", "secret")
+	t.Setenv("GITLAB_TOKEN", "")
+
+	config := &Config{}
+	config.Application.Dc, config.Application.Env = "we1", "dev"
+	results := []checkResult{{Scope: "blueprints", Title: "Blueprints", Findings: []Finding{
+		{Check: "blueprints", Severity: severityError, Blueprint: "infrastructure-test-cache", Dc: "we1", Env: "dev", VM: "vm-1", FileName: "blueprints/cache.yaml", Line: 12, Message: "VM vm-1 doesn't exist"},
+	}}}
+
+	return gitlab, config, results
+}
+
+func TestCommentMergeRequestCreate(t *testing.T) {
+	gitlab, config, results := setupMergeRequestTest(t,
+		mergeRequestNote{ID: 1, Body: "Looks good"},
+		mergeRequestNote{ID: 2, Body: "<!-- bpcleaner ne1-prd -->\nOther dc-env"},
+		mergeRequestNote{ID: 3, Body: "Please rebase"},
+	)
+
+	if err := commentMergeRequest(results, config); err != nil {
+		t.Fatalf("commentMergeRequest: %v", err)
+	}
+
+	if fmt.Sprint(gitlab.pages) != "[1 2]" {
+		t.Errorf("requested note pages %v, want [1 2]", gitlab.pages)
+	}
+	if len(gitlab.updated) != 0 {
+		t.Errorf("updated notes %v, want none without a comment of we1-dev", gitlab.updated)
+	}
+	if len(gitlab.created) != 1 {
+		t.Fatalf("created %d notes, want 1", len(gitlab.created))
+	}
+	comment := gitlab.created[0]
+	if !strings.HasPrefix(comment, "<!-- bpcleaner we1-dev -->\n") {
+		t.Errorf("comment doesn't start with the marker of we1-dev: %q", comment)
+	}
+	if link := "(https://gitlab.example.com/platform/blueprints/-/blob/0123abcd/blueprints/cache.yaml#L12)"; !strings.Contains(comment, link) {
+		t.Errorf("comment doesn't link the finding to the pipeline commit %s:\n%s", link, comment)
+	}
+	if config.Application.ReportLinkBaseURL != "" {
+		t.Errorf("ReportLinkBaseURL = %q, want the configuration unchanged", config.Application.ReportLinkBaseURL)
+	}
+}
+
+func TestCommentMergeRequestUpdate(t *testing.T) {
+	gitlab, config, results := setupMergeRequestTest(t,
+		mergeRequestNote{ID: 1, Body: "Looks good"},
+		mergeRequestNote{ID: 2, Body: "<!-- bpcleaner ne1-prd -->\nOther dc-env"},
+		mergeRequestNote{ID: 3, Body: "<!-- bpcleaner we1-dev -->\nPrevious pipeline"},
+		mergeRequestNote{ID: 4, Body: "<!-- bpcleaner we1-dev -->\nDuplicate"},
+		mergeRequestNote{ID: 5, Body: "Please rebase"},
+	)
+	config.Application.ReportLinkBaseURL = "https://git.example.com/blueprints/"
+
+	if err := commentMergeRequest(results, config); err != nil {
+		t.Fatalf("commentMergeRequest: %v", err)
+	}
+
+	if fmt.Sprint(gitlab.pages) != "[1 2]" {
+		t.Errorf("requested note pages %v, want [1 2] up to the comment of we1-dev", gitlab.pages)
+	}
+	if len(gitlab.created) != 0 {
+		t.Errorf("created %d notes, want the comment of the previous pipeline updated", len(gitlab.created))
+	}
+	if len(gitlab.updated) != 1 || !strings.HasPrefix(gitlab.updated[3], "<!-- bpcleaner we1-dev -->\n") {
+		t.Fatalf("updated notes %v, want note 3 only", gitlab.updated)
+	}
+	if link := "(https://git.example.com/blueprints/blueprints/cache.yaml#L12)"; !strings.Contains(gitlab.updated[3], link) {
+		t.Errorf("comment doesn't use the configured link base %s:\n%s", link, gitlab.updated[3])
+	}
+}
+
+func TestCommentMergeRequestError(t *testing.T) {
+	_, config, results := setupMergeRequestTest(t)
+	t.Setenv("BPCLEANER_GITLAB_TOKEN", "expired")
+
+	err := commentMergeRequest(results, config)
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("commentMergeRequest error = %v, want the GitLab error", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// azureCallDurations is the histogram of the Azure CLI calls durations by command, e.g. vm show
+var azureCallDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "bpcleaner_azure_call_duration_seconds",
+	Help:    "Duration of the Azure CLI calls by command",
+	Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+}, []string{"command"})
+
+// azureCommandName returns the command of Azure CLI arguments without its parameters, e.g. vm show
+func azureCommandName(args []string) string {
+	var command []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") || len(command) == 2 {
+			break
+		}
+		command = append(command, arg)
+	}
+	return strings.Join(command, " ")
+}
+
+// timestampSeconds returns a time as Unix seconds, 0 for the zero time
+func timestampSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// serverMetrics are the collectors of the metrics endpoint, filled from the last run at every scrape
+type serverMetrics struct {
+	mu             sync.Mutex
+	handler        http.Handler
+	findings       *prometheus.GaugeVec
+	checkFindings  *prometheus.GaugeVec
+	expectedVMs    *prometheus.GaugeVec
+	actualVMs      *prometheus.GaugeVec
+	unknownVMs     *prometheus.GaugeVec
+	lastRun        prometheus.Gauge
+	lastSuccess    prometheus.Gauge
+	lastRunSuccess prometheus.Gauge
+	runDuration    prometheus.Gauge
+}
+
+// newServerMetrics creates and registers the collectors of the metrics endpoint
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{
+		findings: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bpcleaner_findings",
+			Help: "Findings of the last successful run by check, severity, dc-env and maintainers group, a finding of several maintainers groups is counted for each of them",
+		}, []string{"check", "severity", "dc", "env", "maintainer"}),
+		checkFindings: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bpcleaner_check_findings",
+			Help: "Findings of the last successful run by check, severity and dc-env, each finding counted once",
+		}, []string{"check", "severity", "dc", "env"}),
+		expectedVMs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bpcleaner_blueprint_vms_expected",
+			Help: "VM instances declared by the blueprint in the dc-env",
+		}, []string{"blueprint", "dc", "env"}),
+		actualVMs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bpcleaner_blueprint_vms_actual",
+			Help: "VM instances of the blueprint existing in Azure",
+		}, []string{"blueprint", "dc", "env"}),
+		unknownVMs: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "bpcleaner_blueprint_vms_unknown",
+			Help: "VM instances of the blueprint that could not be looked up in Azure",
+		}, []string{"blueprint", "dc", "env"}),
+		lastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bpcleaner_last_run_timestamp_seconds",
+			Help: "Time of the last run of the checks",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bpcleaner_last_successful_run_timestamp_seconds",
+			Help: "Time of the last successful run of the checks",
+		}),
+		lastRunSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bpcleaner_last_run_success",
+			Help: "Whether the last run of the checks succeeded",
+		}),
+		runDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "bpcleaner_run_duration_seconds",
+			Help: "Duration of the last successful run of the checks and inventory",
+		}),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.findings, m.checkFindings, m.expectedVMs, m.actualVMs, m.unknownVMs, m.lastRun, m.lastSuccess, m.lastRunSuccess, m.runDuration, azureCallDurations)
+	m.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	return m
+}
+
+// handleMetrics exposes the cleanup debt of the last successful run and the Azure CLI calls durations in the Prometheus text format
+func (s *serverState) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Series of the blueprints, maintainers and VMs gone since the previous run are dropped
+	for _, vec := range []*prometheus.GaugeVec{m.findings, m.checkFindings, m.expectedVMs, m.actualVMs, m.unknownVMs} {
+		vec.Reset()
+	}
+	m.runDuration.Set(0)
+
+	s.mu.RLock()
+	if s.run != nil {
+		// Every check reports its totals, 0 once its findings are fixed
+		for _, c := range checks {
+			for _, severity := range []string{severityError, severityWarning, severityInfo} {
+				m.checkFindings.WithLabelValues(c.Scope, severity, s.run.Dc, s.run.Env)
+			}
+		}
+		for _, finding := range s.run.Findings {
+			maintainers := finding.Maintainers
+			if len(maintainers) == 0 {
+				maintainers = []string{noMaintainer}
+			}
+			dc, env := finding.Dc, finding.Env
+			if dc == "" && env == "" {
+				dc, env = s.run.Dc, s.run.Env
+			}
+			for _, maintainer := range maintainers {
+				m.findings.WithLabelValues(finding.Check, finding.Severity, dc, env, maintainer).Inc()
+			}
+			m.checkFindings.WithLabelValues(finding.Check, finding.Severity, dc, env).Inc()
+		}
+		for _, row := range s.inventory {
+			m.expectedVMs.WithLabelValues(row.Blueprint, row.Datacenter, row.Environment).Inc()
+			actual := m.actualVMs.WithLabelValues(row.Blueprint, row.Datacenter, row.Environment)
+			if row.Exists != nil && *row.Exists {
+				actual.Inc()
+			}
+			unknown := m.unknownVMs.WithLabelValues(row.Blueprint, row.Datacenter, row.Environment)
+			if row.Exists == nil {
+				unknown.Inc()
+			}
+		}
+		m.runDuration.Set(s.lastDuration.Seconds())
+	}
+	m.lastRun.Set(timestampSeconds(s.lastRun))
+	m.lastSuccess.Set(timestampSeconds(s.lastSuccess))
+	success := 0.0
+	if s.run != nil && s.lastError == "" {
+		success = 1
+	}
+	m.lastRunSuccess.Set(success)
+	s.mu.RUnlock()
+
+	m.handler.ServeHTTP(w, r)
+}
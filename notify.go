@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// notificationFindingsLimit is the number of findings listed in a Slack message, the others are counted
+const notificationFindingsLimit = 20
+
+// notificationRoute holds the findings posted to one channel
+type notificationRoute struct {
+	// Channel is the Slack contact of the blueprints, empty for the default channel of the webhook
+	Channel     string
+	Maintainers []string
+	Findings    []Finding
+}
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+// webhookMessage is the payload of a generic JSON webhook
+type webhookMessage struct {
+	Dc          string    `json:"dc"`
+	Env         string    `json:"env"`
+	Channel     string    `json:"channel,omitempty"`
+	Maintainers []string  `json:"maintainers,omitempty"`
+	Findings    []Finding `json:"findings"`
+}
+
+// blueprintSlackContact returns the Slack channel of the telemetry.alerting.contacts block of a blueprint, e.g. #caching-alerts
+func blueprintSlackContact(yamlData map[string]interface{}) string {
+	telemetry, _ := yamlData["telemetry"].(map[interface{}]interface{})
+	alerting, _ := telemetry["alerting"].(map[interface{}]interface{})
+	contacts, _ := alerting["contacts"].(map[interface{}]interface{})
+	channel, _ := contacts["slack"].(string)
+	channel = strings.TrimSpace(channel)
+	if channel != "" && !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel
+	}
+	return channel
+}
+
+// routeFindings groups the findings by the Slack contact of their blueprint file
+func routeFindings(findings []Finding) []*notificationRoute {
+	var fileNames []string
+	seen := make(map[string]bool)
+	for _, finding := range findings {
+		if !seen[finding.FileName] {
+			seen[finding.FileName] = true
+			fileNames = append(fileNames, finding.FileName)
+		}
+	}
+	channels := make(map[string]string)
+	for _, file := range loadYAMLFiles(fileNames) {
+		channels[file.FileName] = blueprintSlackContact(file.Data)
+	}
+
+	routes := make(map[string]*notificationRoute)
+	var sorted []*notificationRoute
+	for _, finding := range findings {
+		channel := channels[finding.FileName]
+		route, ok := routes[channel]
+		if !ok {
+			route = &notificationRoute{Channel: channel}
+			routes[channel] = route
+			sorted = append(sorted, route)
+		}
+		for _, maintainer := range finding.Maintainers {
+			if !listContainsString(route.Maintainers, maintainer) {
+				route.Maintainers = append(route.Maintainers, maintainer)
+			}
+		}
+		route.Findings = append(route.Findings, finding)
+	}
+
+	// Default channel first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Channel < sorted[j].Channel
+	})
+
+	return sorted
+}
+
+// listContainsString checks if a string exists in a list
+func listContainsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// slackEscaper escapes the characters Slack mrkdwn uses for links and mentions
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackText summarises the findings of a route in Slack mrkdwn
+func slackText(route *notificationRoute, config *Config) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "*bpcleaner %s-%s*: %d new cleanup findings", slackEscaper.Replace(config.Application.Dc), slackEscaper.Replace(config.Application.Env), len(route.Findings))
+	if len(route.Maintainers) > 0 {
+		fmt.Fprintf(&b, " for %s", slackEscaper.Replace(strings.Join(route.Maintainers, ", ")))
+	}
+	b.WriteString("\n")
+	for i, finding := range route.Findings {
+		if i == notificationFindingsLimit {
+			fmt.Fprintf(&b, "… and %d more\n", len(route.Findings)-notificationFindingsLimit)
+			break
+		}
+		fmt.Fprintf(&b, "• `%s` %s\n", slackEscaper.Replace(finding.Check), slackEscaper.Replace(finding.describe()))
+	}
+
+	return b.String()
+}
+
+// postWebhook posts a JSON payload to a webhook URL
+func postWebhook(client *http.Client, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting to webhook: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("error posting to webhook: %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// notifyFindings posts the findings to the configured webhook, one message per Slack contact of their blueprints
+func notifyFindings(findings []Finding, config *Config) error {
+	if config.Application.NotifyWebhookURL == "" {
+		return fmt.Errorf("notifyWebhookURL not configured")
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	for _, route := range routeFindings(findings) {
+		var payload interface{}
+		switch config.Application.NotifyFormat {
+		case "", "slack":
+			payload = slackMessage{Channel: route.Channel, Text: slackText(route, config)}
+		case "json":
+			payload = webhookMessage{Dc: config.Application.Dc, Env: config.Application.Env, Channel: route.Channel, Maintainers: route.Maintainers, Findings: route.Findings}
+		default:
+			return fmt.Errorf("unknown notifyFormat %s, expected slack or json", config.Application.NotifyFormat)
+		}
+
+		if err := postWebhook(client, config.Application.NotifyWebhookURL, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// webhookStub records the JSON payloads posted to it
+type webhookStub struct {
+	mu       sync.Mutex
+	payloads []json.RawMessage
+	status   int
+}
+
+func (s *webhookStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var payload json.RawMessage
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&payload) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	s.payloads = append(s.payloads, payload)
+	if s.status != 0 {
+		http.Error(w, "invalid_token", s.status)
+	}
+}
+
+// notificationTestFindings writes a blueprint with a Slack contact and one without, and returns a finding of each
+func notificationTestFindings(t *testing.T) []Finding {
+	t.Helper()
+	directory := t.TempDir()
+
+	routed := filepath.Join(directory, "routed.yaml")
+	content := "platform: infrastructure\nboundary: test\nname: routed\ntelemetry:\n  alerting:\n    contacts:\n      slack: caching-alerts\n"
+	if err := os.WriteFile(routed, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unrouted := writeTestBlueprint(t, directory, "unrouted", "we1-dev")
+
+	return []Finding{
+		{Check: "blueprints", Severity: severityError, Blueprint: "infrastructure-test-routed", FileName: routed, Message: "VM <vm-1> & <vm-2> don't exist", Maintainers: []string{"team-routed"}},
+		{Check: "blueprints-ips", Severity: severityWarning, Blueprint: "infrastructure-test-unrouted", FileName: unrouted, Message: "IPs are not in order", Maintainers: []string{"team-unrouted"}},
+		{Check: "blueprints-ips", Severity: severityWarning, Blueprint: "infrastructure-test-routed", FileName: routed, Message: "IPs are not in order", Maintainers: []string{"team-routed", "team-shared"}},
+	}
+}
+
+func TestNotifyFindingsSlack(t *testing.T) {
+	stub := &webhookStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := &Config{}
+	config.Application.Dc, config.Application.Env = "we1", "dev"
+	config.Application.NotifyWebhookURL = server.URL
+
+	if err := notifyFindings(notificationTestFindings(t), config); err != nil {
+		t.Fatalf("notifyFindings: %v", err)
+	}
+
+	if len(stub.payloads) != 2 {
+		t.Fatalf("posted %d messages, want one per channel", len(stub.payloads))
+	}
+	var messages []slackMessage
+	for _, payload := range stub.payloads {
+		var message slackMessage
+		if err := json.Unmarshal(payload, &message); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+	}
+
+	// Blueprints without a Slack contact go to the default channel of the webhook, first
+	if messages[0].Channel != "" || !strings.Contains(messages[0].Text, "1 new cleanup findings for team-unrouted") {
+		t.Errorf("default channel message = %+v", messages[0])
+	}
+	if messages[1].Channel != "#caching-alerts" {
+		t.Errorf("routed message channel = %q, want #caching-alerts", messages[1].Channel)
+	}
+	wantText := "*bpcleaner we1-dev*: 2 new cleanup findings for team-routed, team-shared\n" +
+		"• `blueprints` VM &lt;vm-1&gt; &amp; &lt;vm-2&gt; don't exist\n" +
+		"• `blueprints-ips` IPs are not in order\n"
+	if messages[1].Text != wantText {
+		t.Errorf("routed message text = %q, want %q", messages[1].Text, wantText)
+	}
+}
+
+func TestNotifyFindingsJSON(t *testing.T) {
+	stub := &webhookStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := &Config{}
+	config.Application.Dc, config.Application.Env = "we1", "dev"
+	config.Application.NotifyWebhookURL = server.URL
+	config.Application.NotifyFormat = "json"
+
+	findings := notificationTestFindings(t)
+	if err := notifyFindings(findings, config); err != nil {
+		t.Fatalf("notifyFindings: %v", err)
+	}
+
+	if len(stub.payloads) != 2 {
+		t.Fatalf("posted %d messages, want one per channel", len(stub.payloads))
+	}
+	var message webhookMessage
+	if err := json.Unmarshal(stub.payloads[1], &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Dc != "we1" || message.Env != "dev" || message.Channel != "#caching-alerts" {
+		t.Errorf("message = %+v, want we1-dev to #caching-alerts", message)
+	}
+	if strings.Join(message.Maintainers, ",") != "team-routed,team-shared" {
+		t.Errorf("maintainers = %v", message.Maintainers)
+	}
+	if len(message.Findings) != 2 || message.Findings[0].Message != findings[0].Message || message.Findings[1].Check != "blueprints-ips" {
+		t.Errorf("findings = %+v, want the findings of the routed blueprint unescaped", message.Findings)
+	}
+}
+
+func TestNotifyFindingsError(t *testing.T) {
+	stub := &webhookStub{status: http.StatusForbidden}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := &Config{}
+	config.Application.NotifyWebhookURL = server.URL
+
+	err := notifyFindings(notificationTestFindings(t), config)
+	if err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("notifyFindings error = %v, want the webhook error", err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// reportWriters are the -output formats other than the text cleanup suggestions
+var reportWriters = map[string]func(w io.Writer, run checkRun, config *Config) error{
+	"sarif":    writeSARIFReport,
+	"junit":    writeJUnitReport,
+	"markdown": writeMarkdownReport,
+	"html":     writeHTMLReport,
+	"csv":      writeInventoryCSV,
+}
+
+// outputFormats lists the -output values
+func outputFormats() string {
+	formats := []string{"text"}
+	for format := range reportWriters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats[1:])
+	return strings.Join(formats, ", ")
+}
+
+// validateOutputFormat checks the -output value before running the checks
+func validateOutputFormat(format string) error {
+	if _, ok := reportWriters[format]; !ok && format != "text" {
+		return fmt.Errorf("unknown output format %s, expected one of %s", format, outputFormats())
+	}
+	return nil
+}
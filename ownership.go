@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// teamDirectory holds the people, distribution lists and groups known by the organisation
+type teamDirectory struct {
+	// People maps an email to its status, e.g. active or left
+	People            map[string]string
+	DistributionLists map[string]bool
+	Groups            map[string]bool
+}
+
+// teamDirectoryFile is the YAML format of the team directory
+type teamDirectoryFile struct {
+	People []struct {
+		Email  string `yaml:"email"`
+		Status string `yaml:"status"`
+	} `yaml:"people"`
+	DistributionLists []string `yaml:"distribution_lists"`
+	Groups            []string `yaml:"groups"`
+}
+
+// normalizeDirectoryName makes emails and group names comparable
+func normalizeDirectoryName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// readTeamDirectory reads the team directory from a YAML file or a CSV file with type,name,status columns
+func readTeamDirectory(directoryFile string) (*teamDirectory, error) {
+	fileContent, err := ioutil.ReadFile(directoryFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading team directory: %v", err)
+	}
+
+	directory := &teamDirectory{
+		People:            make(map[string]string),
+		DistributionLists: make(map[string]bool),
+		Groups:            make(map[string]bool),
+	}
+
+	if strings.EqualFold(filepath.Ext(directoryFile), ".csv") {
+		reader := csv.NewReader(strings.NewReader(string(fileContent)))
+		// The status column is optional
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing team directory: %v", err)
+		}
+
+		for i, record := range records {
+			if len(record) < 2 {
+				return nil, fmt.Errorf("error parsing team directory: line %d needs at least type and name", i+1)
+			}
+			kind := normalizeDirectoryName(record[0])
+			name := normalizeDirectoryName(record[1])
+			status := "active"
+			if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+				status = normalizeDirectoryName(record[2])
+			}
+
+			switch kind {
+			case "type":
+				// Header
+			case "person":
+				directory.People[name] = status
+			case "distribution_list":
+				directory.DistributionLists[name] = true
+			case "group":
+				directory.Groups[name] = true
+			default:
+				return nil, fmt.Errorf("error parsing team directory: unknown type %q on line %d", record[0], i+1)
+			}
+		}
+
+		return directory, nil
+	}
+
+	var file teamDirectoryFile
+	if err := yaml.Unmarshal(fileContent, &file); err != nil {
+		return nil, fmt.Errorf("error parsing team directory: %v", err)
+	}
+	for _, person := range file.People {
+		status := normalizeDirectoryName(person.Status)
+		if status == "" {
+			status = "active"
+		}
+		directory.People[normalizeDirectoryName(person.Email)] = status
+	}
+	for _, dl := range file.DistributionLists {
+		directory.DistributionLists[normalizeDirectoryName(dl)] = true
+	}
+	for _, group := range file.Groups {
+		directory.Groups[normalizeDirectoryName(group)] = true
+	}
+
+	return directory, nil
+}
+
+// ownershipProblem is a problem of the ownership metadata at a path of the blueprint
+type ownershipProblem struct {
+	path    []interface{}
+	message string
+}
+
+// checkOwnership returns the problems of the ownership metadata of a blueprint
+func checkOwnership(yamlData map[string]interface{}, directory *teamDirectory) []ownershipProblem {
+	var problems []ownershipProblem
+
+	for _, key := range []string{"owner", "technical_owner"} {
+		value, ok := yamlData[key].(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			problems = append(problems, ownershipProblem{[]interface{}{key}, fmt.Sprintf("has no %s", key)})
+			continue
+		}
+		status, known := directory.People[normalizeDirectoryName(value)]
+		if !known {
+			problems = append(problems, ownershipProblem{[]interface{}{key}, fmt.Sprintf("has %s %s who is not in the team directory", key, strings.TrimSpace(value))})
+		} else if status != "active" {
+			problems = append(problems, ownershipProblem{[]interface{}{key}, fmt.Sprintf("has %s %s who is %s", key, strings.TrimSpace(value), status)})
+		}
+	}
+
+	for _, key := range []string{"owner_dl", "technical_owner_dl"} {
+		value, ok := yamlData[key].(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			problems = append(problems, ownershipProblem{[]interface{}{key}, fmt.Sprintf("has no %s", key)})
+			continue
+		}
+		if !directory.DistributionLists[normalizeDirectoryName(value)] {
+			problems = append(problems, ownershipProblem{[]interface{}{key}, fmt.Sprintf("has %s %s which does not exist", key, strings.TrimSpace(value))})
+		}
+	}
+
+	for _, key := range []string{"maintainers", "provider_maintainers"} {
+		groups, _ := yamlData[key].([]interface{})
+		for index, group := range groups {
+			if name, ok := group.(string); !ok || !directory.Groups[normalizeDirectoryName(name)] {
+				problems = append(problems, ownershipProblem{[]interface{}{key, index}, fmt.Sprintf("has unknown %s group %v", key, group)})
+			}
+		}
+	}
+
+	return problems
+}
+
+func checkBlueprintsOwnership(fileNames []string, config *Config) ([]Finding, error) {
+	if config.Application.TeamDirectoryPath == "" {
+		return nil, skippedCheck{"teamDirectoryPath not configured"}
+	}
+	directory, err := readTeamDirectory(config.Application.TeamDirectoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store cleanup guidance
+	var findings []Finding
+
+	for _, file := range targetFiles(loadYAMLFiles(fileNames), config) {
+		pbn := blueprintPBN(file.Data)
+
+		problems := checkOwnership(file.Data, directory)
+		if len(problems) == 0 {
+			slog.Debug("Blueprint ownership is valid", "blueprint", pbn)
+		}
+		for _, problem := range problems {
+			slog.Info("Blueprint "+problem.message, "blueprint", pbn)
+			findings = append(findings, newFinding("blueprints-ownership", severityWarning, file.Data, file.FileName, fmt.Sprintf("Blueprint %s %s. Check file %s", pbn, problem.message, file.FileName)).at(problem.path...))
+		}
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName lists path globs to skip, one per line, at the root of a blueprints directory
+const ignoreFileName = ".bpcleanerignore"
+
+// pathFilter decides which files of a blueprints directory are walked
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+// newPathFilter builds the filter of a directory from the configured globs and its ignore file
+func newPathFilter(directoryPath string, config *Config) (*pathFilter, error) {
+	filter := &pathFilter{
+		include: config.Application.IncludePaths,
+		exclude: append([]string{".git/"}, config.Application.ExcludePaths...),
+	}
+	for _, pattern := range append(append([]string{}, filter.include...), filter.exclude...) {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid path glob %q: %v", pattern, err)
+		}
+	}
+
+	ignoreFile, err := os.Open(filepath.Join(directoryPath, ignoreFileName))
+	if os.IsNotExist(err) {
+		return filter, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer ignoreFile.Close()
+
+	scanner := bufio.NewScanner(ignoreFile)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid path glob %q on line %d of %s: %v", pattern, line, ignoreFileName, err)
+		}
+		filter.exclude = append(filter.exclude, pattern)
+	}
+
+	return filter, scanner.Err()
+}
+
+// matchPathGlob matches a slash separated path with a glob where ** matches any number of directories.
+// A glob without a slash matches the base name at any depth and a glob ending with a slash only matches directories.
+func matchPathGlob(pattern string, relativePath string, isDir bool) bool {
+	if strings.HasSuffix(pattern, "/") {
+		if !isDir {
+			return false
+		}
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	return matchPathSegments(strings.Split(pattern, "/"), strings.Split(relativePath, "/"))
+}
+
+func matchPathSegments(patterns []string, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchPathSegments(patterns[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(patterns[0], segments[0]); !matched {
+		return false
+	}
+	return matchPathSegments(patterns[1:], segments[1:])
+}
+
+// skipDir checks if a directory is excluded
+func (f *pathFilter) skipDir(relativePath string) bool {
+	for _, pattern := range f.exclude {
+		if matchPathGlob(pattern, relativePath, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// includesFile checks if a file is included and not excluded, every file is included without include globs
+func (f *pathFilter) includesFile(relativePath string) bool {
+	for _, pattern := range f.exclude {
+		if matchPathGlob(pattern, relativePath, false) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if matchPathGlob(pattern, relativePath, false) {
+			return true
+		}
+	}
+	return false
+}
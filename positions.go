@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	yamlnode "gopkg.in/yaml.v3"
+)
+
+// yamlDocument is a parsed YAML file with the positions of its nodes
+type yamlDocument struct {
+	modTime time.Time
+	root    *yamlnode.Node
+}
+
+// yamlDocuments caches the parsed YAML files until they are modified
+var yamlDocuments = struct {
+	sync.Mutex
+	files map[string]yamlDocument
+}{files: make(map[string]yamlDocument)}
+
+// yamlDocumentRoot returns the top level node of a YAML file, nil when it can't be parsed
+func yamlDocumentRoot(fileName string) *yamlnode.Node {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil
+	}
+
+	yamlDocuments.Lock()
+	defer yamlDocuments.Unlock()
+
+	if document, ok := yamlDocuments.files[fileName]; ok && document.modTime.Equal(info.ModTime()) {
+		return document.root
+	}
+
+	var root *yamlnode.Node
+	if fileContent, err := ioutil.ReadFile(fileName); err == nil {
+		var document yamlnode.Node
+		if err := yamlnode.Unmarshal(fileContent, &document); err == nil && len(document.Content) > 0 {
+			root = document.Content[0]
+		}
+	}
+	yamlDocuments.files[fileName] = yamlDocument{modTime: info.ModTime(), root: root}
+
+	return root
+}
+
+// yamlPosition returns the line and column of the node at a path of map keys (string) and list indexes (int).
+// The position of the deepest node found is returned when the path doesn't fully exist, 0 when the file can't be parsed.
+func yamlPosition(fileName string, path ...interface{}) (int, int) {
+	node := yamlDocumentRoot(fileName)
+	if node == nil {
+		return 0, 0
+	}
+	line, column := node.Line, node.Column
+
+	for _, element := range path {
+		var next *yamlnode.Node
+		switch key := element.(type) {
+		case string:
+			if node.Kind != yamlnode.MappingNode {
+				break
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					// Point to the key, its value may be on the next lines
+					line, column = node.Content[i].Line, node.Content[i].Column
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if node.Kind == yamlnode.SequenceNode && key >= 0 && key < len(node.Content) {
+				next = node.Content[key]
+				line, column = next.Line, next.Column
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	return line, column
+}
+
+// yamlPath formats a path of map keys and list indexes, e.g. environment_specific[0].virtual_machines[1]
+func yamlPath(path ...interface{}) string {
+	var b strings.Builder
+	for _, element := range path {
+		switch key := element.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", key)
+		default:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			fmt.Fprint(&b, key)
+		}
+	}
+	return b.String()
+}
+
+// yamlEnvironmentIndex returns the index of the environment_specific entry of a dc-env in a YAML file, -1 when not found
+func yamlEnvironmentIndex(fileName string, dc string, env string) int {
+	index, _ := yamlEnvironmentNode(fileName, dc, env)
+	return index
+}
+
+// yamlEnvironmentNode returns the index and node of the environment_specific entry of a dc-env in a YAML file, -1 and nil when not found
+func yamlEnvironmentNode(fileName string, dc string, env string) (int, *yamlnode.Node) {
+	root := yamlDocumentRoot(fileName)
+	if root == nil || root.Kind != yamlnode.MappingNode {
+		return -1, nil
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "environment_specific" || root.Content[i+1].Kind != yamlnode.SequenceNode {
+			continue
+		}
+		for index, item := range root.Content[i+1].Content {
+			values := make(map[string]string)
+			for j := 0; j+1 < len(item.Content); j += 2 {
+				values[item.Content[j].Value] = item.Content[j+1].Value
+			}
+			if values["datacenter"] == dc && values["environment"] == env {
+				return index, item
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+// yamlLastLine returns the last line of a node and its children, including the lines of multi-line scalars
+func yamlLastLine(node *yamlnode.Node) int {
+	last := node.Line
+	if node.Kind == yamlnode.ScalarNode && node.Style&(yamlnode.LiteralStyle|yamlnode.FoldedStyle) != 0 {
+		// Block scalars start on the line after their indicator
+		last += strings.Count(strings.TrimSuffix(node.Value, "\n"), "\n") + 1
+	}
+	for _, child := range node.Content {
+		if line := yamlLastLine(child); line > last {
+			last = line
+		}
+	}
+	return last
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// noMaintainer groups the blueprints and findings without maintainers in the owners report
+const noMaintainer = "(none)"
+
+// ownerReport holds the cleanup debt of a maintainers group
+type ownerReport struct {
+	Maintainer   string
+	Blueprints   int
+	Environments int
+	VMInstances  int
+	// Findings counts the findings by severity
+	Findings map[string]int
+	// Suppressed counts the findings suppressed by waivers
+	Suppressed int
+}
+
+// buildOwnersReport totals the blueprints, environments, VM instances and findings of every maintainers group in the configured dc-env
+func buildOwnersReport(blueprints []yamlFile, results []checkResult, config *Config) []*ownerReport {
+	reports := make(map[string]*ownerReport)
+	report := func(maintainer string) *ownerReport {
+		if _, ok := reports[maintainer]; !ok {
+			reports[maintainer] = &ownerReport{Maintainer: maintainer, Findings: make(map[string]int)}
+		}
+		return reports[maintainer]
+	}
+	maintainersOrNone := func(maintainers []string) []string {
+		if len(maintainers) == 0 {
+			return []string{noMaintainer}
+		}
+		return maintainers
+	}
+
+	for _, file := range blueprints {
+		// Like the findings, only the environments of the configured dc-env are counted
+		var environments []map[interface{}]interface{}
+		for _, envMap := range environmentEntries(file.Data) {
+			if envMap["environment"] == config.Application.Env && envMap["datacenter"] == config.Application.Dc {
+				environments = append(environments, envMap)
+			}
+		}
+		if len(environments) == 0 {
+			continue
+		}
+
+		instances := 0
+		for _, envMap := range environments {
+			if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
+				for _, vm := range vmList {
+					if vmMap, ok := vm.(map[interface{}]interface{}); ok {
+						count, _ := vmMap["count"].(int)
+						instances += count
+					}
+				}
+			}
+		}
+
+		for _, maintainer := range maintainersOrNone(blueprintMaintainers(file.Data)) {
+			r := report(maintainer)
+			r.Blueprints++
+			r.Environments += len(environments)
+			r.VMInstances += instances
+		}
+	}
+
+	for _, result := range results {
+		for _, finding := range result.Findings {
+			for _, maintainer := range maintainersOrNone(finding.Maintainers) {
+				report(maintainer).Findings[finding.Severity]++
+			}
+		}
+		for _, finding := range result.Suppressed {
+			for _, maintainer := range maintainersOrNone(finding.Maintainers) {
+				report(maintainer).Suppressed++
+			}
+		}
+	}
+
+	var sorted []*ownerReport
+	for _, r := range reports {
+		sorted = append(sorted, r)
+	}
+	// Most cleanup debt first
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Findings[severityError] != b.Findings[severityError] {
+			return a.Findings[severityError] > b.Findings[severityError]
+		}
+		if a.Findings[severityWarning] != b.Findings[severityWarning] {
+			return a.Findings[severityWarning] > b.Findings[severityWarning]
+		}
+		return a.Maintainer < b.Maintainer
+	})
+
+	return sorted
+}
+
+// writeOwnersReport writes the owners report as a table
+func writeOwnersReport(w io.Writer, reports []*ownerReport) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(table, "MAINTAINER\tBLUEPRINTS\tENVIRONMENTS\tVM INSTANCES\tERRORS\tWARNINGS\tINFO\tSUPPRESSED")
+	for _, r := range reports {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", r.Maintainer, r.Blueprints, r.Environments, r.VMInstances, r.Findings[severityError], r.Findings[severityWarning], r.Findings[severityInfo], r.Suppressed)
+	}
+
+	return table.Flush()
+}
+
+// runReportCommand runs the report subcommands, e.g. bpcleaner report owners -config <config file>
+func runReportCommand(args []string) {
+	if len(args) == 0 || args[0] != "owners" {
+		fmt.Fprintf(os.Stderr, "Usage: bpcleaner report owners -config <config file> [-scope <scope>] [-out <file>]\n")
+		return
+	}
+
+	// Define command-line flags
+	var configFile string
+	var scope string
+	var weeks int
+	var output outputOptions
+	flags := flag.NewFlagSet("report owners", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Path to the configuration file")
+	flags.StringVar(&scope, "scope", "all", "Checks whose findings are counted, same values as the main -scope flag")
+	flags.IntVar(&weeks, "weeks", 4, "Number of weeks covered by the schedule checks")
+	output.register(flags)
+	flags.Parse(args[1:])
+
+	if err := output.setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+
+	// Read configuration from the file
+	config, err := readConfig(configFile)
+	if err != nil {
+		slog.Error("Error reading configuration", "error", err)
+		return
+	}
+
+	// The report covers every team
+	config.allTeams = true
+
+	// Login to Azure CLI if needed
+	if err := azureLoginIfNeeded(config.Azure.Cloud); err != nil {
+		slog.Error("Error logging in to Azure CLI", "error", err)
+		return
+	}
+
+	results, err := runChecks(&repositoryFiles{config: config}, scope, config, weeks)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	blueprintsFileNames, err := getAllYAMLFiles(config.Application.BlueprintsDirectoryPath, config)
+	if err != nil {
+		slog.Error("Error getting file names", "error", err)
+		return
+	}
+
+	// The report alone goes to stdout or -out
+	report, closeReport, err := output.openReport()
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	fmt.Fprintf(report, "\n\n#############################\n# Cleanup debt by maintainer %s-%s\n#############################\n", config.Application.Dc, config.Application.Env)
+	err = writeOwnersReport(report, buildOwnersReport(loadYAMLFiles(blueprintsFileNames), results, config))
+	if closeErr := closeReport(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		slog.Error("Error writing report", "error", err)
+	}
+}
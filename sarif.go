@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// SARIF 2.1.0 log, only the properties written by bpcleaner
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// sarifLevels maps the finding severities to the SARIF levels
+var sarifLevels = map[string]string{
+	severityError:   "error",
+	severityWarning: "warning",
+	severityInfo:    "note",
+}
+
+// repositoryURIs caches the git top level directory of the directories of the findings files
+type repositoryURIs struct {
+	topLevels map[string]string
+}
+
+// uri returns the URI of a file relative to its git repository, so code scanning can match it, or of the path as is outside of git
+func (r *repositoryURIs) uri(fileName string) string {
+	directory := filepath.Dir(fileName)
+	topLevel, ok := r.topLevels[directory]
+	if !ok {
+		if output, err := runGit(directory, "rev-parse", "--show-toplevel"); err == nil {
+			topLevel = strings.TrimSpace(output)
+		}
+		r.topLevels[directory] = topLevel
+	}
+
+	path := filepath.ToSlash(fileName)
+	if topLevel != "" {
+		if relativePath, err := filepath.Rel(topLevel, canonicalPath(fileName)); err == nil {
+			path = filepath.ToSlash(relativePath)
+		}
+	}
+	return (&url.URL{Path: path}).String()
+}
+
+// writeSARIFReport writes the findings as a SARIF 2.1.0 log with one rule per check
+func writeSARIFReport(w io.Writer, run checkRun, config *Config) error {
+	driver := sarifDriver{Name: "bpcleaner"}
+	ruleIndexes := make(map[string]int)
+	for _, c := range append(checks, check{Scope: "waivers", Title: "Waivers"}) {
+		ruleIndexes[c.Scope] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, sarifRule{ID: c.Scope, Name: c.Title, ShortDescription: sarifMessage{Text: c.Title + " cleanup suggestions"}})
+	}
+
+	uris := &repositoryURIs{topLevels: make(map[string]string)}
+	report := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	for _, result := range run.results {
+		for _, finding := range result.Findings {
+			sarif := sarifResult{
+				RuleID:              finding.Check,
+				RuleIndex:           ruleIndexes[finding.Check],
+				Level:               sarifLevels[finding.Severity],
+				Message:             sarifMessage{Text: finding.text()},
+				PartialFingerprints: map[string]string{"bpcleaner/v1": findingFingerprint(finding)},
+			}
+			if finding.FileName != "" {
+				location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uris.uri(finding.FileName)}}}
+				if finding.Line > 0 {
+					location.PhysicalLocation.Region = &sarifRegion{StartLine: finding.Line, StartColumn: finding.Column}
+				}
+				sarif.Locations = []sarifLocation{location}
+			}
+			report.Results = append(report.Results, sarif)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{report},
+	})
+}
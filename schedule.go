@@ -0,0 +1,613 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// patchWindowDuration is the length assumed for every patch window, cron only defines when it starts
+const patchWindowDuration = time.Hour
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// cronSchedule holds the expanded fields of an update blueprint scheduling.cron block
+type cronSchedule struct {
+	minutes            map[int]bool
+	hours              map[int]bool
+	days               map[int]bool
+	months             map[int]bool
+	weekdays           map[int]bool
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// patchWindow is a single occurrence of an update blueprint schedule in a dc-env
+type patchWindow struct {
+	Dc              string
+	Env             string
+	UpdateBlueprint string
+	FileName        string
+	Blueprints      []string
+	Classification  string
+	Count           int
+	Start           time.Time
+	End             time.Time
+	Overlaps        []string
+	Maintainers     []string
+
+	// source identifies the environment entry the window was generated from
+	source string
+}
+
+// windowOverlap describes two patch windows of different update blueprints patching the same blueprint at the same time
+type windowOverlap struct {
+	First      *patchWindow
+	Second     *patchWindow
+	Blueprints []string
+}
+
+// parseCronField expands a single cron field (e.g. "4-9/2", "1,3,5", "*") into the set of values it matches
+func parseCronField(field string, min, max int, names map[string]int) (map[int]bool, error) {
+	values := make(map[int]bool)
+
+	if strings.TrimSpace(field) == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	for _, part := range strings.Split(field, ",") {
+		part = strings.TrimSpace(part)
+
+		// Split the optional step
+		step := 1
+		if rangePart, stepPart, found := strings.Cut(part, "/"); found {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q in %q", stepPart, field)
+			}
+			part = rangePart
+		}
+
+		// Resolve the range
+		var start, end int
+		if part == "*" {
+			start, end = min, max
+		} else if lowPart, highPart, found := strings.Cut(part, "-"); found {
+			low, err := parseCronValue(lowPart, min, max, names)
+			if err != nil {
+				return nil, fmt.Errorf("%v in %q", err, field)
+			}
+			high, err := parseCronValue(highPart, min, max, names)
+			if err != nil {
+				return nil, fmt.Errorf("%v in %q", err, field)
+			}
+			if low > high {
+				return nil, fmt.Errorf("range %q is reversed in %q", part, field)
+			}
+			start, end = low, high
+		} else {
+			value, err := parseCronValue(part, min, max, names)
+			if err != nil {
+				return nil, fmt.Errorf("%v in %q", err, field)
+			}
+			start, end = value, value
+			// "a/step" means from a to the end of the range
+			if step > 1 {
+				end = max
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			values[i] = true
+		}
+	}
+
+	return values, nil
+}
+
+// parseCronValue parses a single number or name of a cron field and checks it's within bounds
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if number, ok := names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if number < min || number > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", number, min, max)
+	}
+
+	return number, nil
+}
+
+// cronFieldExpression returns the expression of a cron field as a string, defaulting when it's not set
+func cronFieldExpression(cron map[interface{}]interface{}, key string, defaultValue string) (string, error) {
+	value, ok := cron[key]
+	if !ok || value == nil {
+		return defaultValue, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	default:
+		return "", fmt.Errorf("cron field %s has unsupported value %v", key, value)
+	}
+}
+
+// parseCronSchedule validates and expands the scheduling.cron block of an update blueprint
+func parseCronSchedule(cron map[interface{}]interface{}) (*cronSchedule, error) {
+	for key := range cron {
+		switch key {
+		case "minute", "hour", "day", "month", "dow":
+		default:
+			return nil, fmt.Errorf("unknown cron field %v", key)
+		}
+	}
+
+	schedule := &cronSchedule{}
+	fields := []struct {
+		key          string
+		defaultValue string
+		min, max     int
+		names        map[string]int
+		target       *map[int]bool
+	}{
+		{"minute", "0", 0, 59, nil, &schedule.minutes},
+		{"hour", "*", 0, 23, nil, &schedule.hours},
+		{"day", "*", 1, 31, nil, &schedule.days},
+		{"month", "*", 1, 12, cronMonthNames, &schedule.months},
+		{"dow", "*", 0, 7, cronWeekdayNames, &schedule.weekdays},
+	}
+
+	for _, field := range fields {
+		expression, err := cronFieldExpression(cron, field.key, field.defaultValue)
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := parseCronField(expression, field.min, field.max, field.names)
+		if err != nil {
+			return nil, fmt.Errorf("cron field %s: %v", field.key, err)
+		}
+		*field.target = values
+
+		if field.key == "day" {
+			schedule.daysRestricted = !strings.HasPrefix(expression, "*")
+		}
+		if field.key == "dow" {
+			schedule.weekdaysRestricted = !strings.HasPrefix(expression, "*")
+		}
+	}
+
+	// Both 0 and 7 mean Sunday
+	if schedule.weekdays[7] {
+		schedule.weekdays[0] = true
+	}
+
+	return schedule, nil
+}
+
+// matches checks if the schedule fires at the given time, following cron semantics for day and dow
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+
+	dayMatch := c.days[t.Day()]
+	weekdayMatch := c.weekdays[int(t.Weekday())]
+	if c.daysRestricted && c.weekdaysRestricted {
+		return dayMatch || weekdayMatch
+	}
+
+	return dayMatch && weekdayMatch
+}
+
+// occurrences returns every time the schedule fires between from (inclusive) and to (exclusive), in the time zone of from
+func (c *cronSchedule) occurrences(from, to time.Time) []time.Time {
+	var times []time.Time
+
+	var minutes []int
+	for minute := range c.minutes {
+		minutes = append(minutes, minute)
+	}
+	sort.Ints(minutes)
+
+	// Hours of the time zone of from, not all of them are a whole number of hours from UTC
+	first := time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), 0, 0, 0, from.Location())
+	for hour := first; hour.Before(to); hour = hour.Add(time.Hour) {
+		for _, minute := range minutes {
+			t := hour.Add(time.Duration(minute) * time.Minute)
+			if !t.Before(from) && t.Before(to) && c.matches(t) {
+				times = append(times, t)
+			}
+		}
+	}
+
+	return times
+}
+
+// environmentSchedule returns the cron schedule of an update blueprint environment, nil if it has no recurring schedule
+func environmentSchedule(envMap map[interface{}]interface{}) (*cronSchedule, error) {
+	scheduling, ok := envMap["scheduling"].(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("scheduling block is missing")
+	}
+
+	settings, _ := scheduling["settings"].(string)
+	cron, ok := scheduling["cron"].(map[interface{}]interface{})
+	if !ok {
+		if settings == "recurring" {
+			return nil, fmt.Errorf("recurring scheduling without a cron block")
+		}
+		return nil, nil
+	}
+
+	return parseCronSchedule(cron)
+}
+
+// environmentInfrastructureBlueprints returns the blueprints patched by an update blueprint environment
+func environmentInfrastructureBlueprints(envMap map[interface{}]interface{}) []string {
+	var blueprints []string
+
+	if vmList, ok := envMap["virtual_machines"].([]interface{}); ok {
+		for _, vm := range vmList {
+			if vmMap, ok := vm.(map[interface{}]interface{}); ok {
+				if blueprint, ok := vmMap["infrastructure_blueprint"].(string); ok {
+					blueprints = append(blueprints, blueprint)
+				}
+			}
+		}
+	}
+
+	return blueprints
+}
+
+// environmentUpdateClassifications returns the update_classifications type and count of an update blueprint environment
+func environmentUpdateClassifications(envMap map[interface{}]interface{}) (string, int) {
+	var classification string
+	var count int
+
+	if classifications, ok := envMap["update_classifications"].(map[interface{}]interface{}); ok {
+		classification, _ = classifications["type"].(string)
+		count, _ = classifications["count"].(int)
+	}
+
+	return classification, count
+}
+
+// collectPatchWindows generates the patch windows between from and to for every update blueprint, skipping invalid schedules
+func collectPatchWindows(updateBlueprints []yamlFile, from, to time.Time) []patchWindow {
+	var windows []patchWindow
+
+	for _, file := range updateBlueprints {
+		for i, envMap := range environmentEntries(file.Data) {
+			schedule, err := environmentSchedule(envMap)
+			if err != nil || schedule == nil {
+				continue
+			}
+
+			dc, _ := envMap["datacenter"].(string)
+			env, _ := envMap["environment"].(string)
+			classification, count := environmentUpdateClassifications(envMap)
+
+			for _, start := range schedule.occurrences(from, to) {
+				windows = append(windows, patchWindow{
+					Dc:              dc,
+					Env:             env,
+					UpdateBlueprint: blueprintPBN(file.Data),
+					FileName:        file.FileName,
+					Blueprints:      environmentInfrastructureBlueprints(envMap),
+					Classification:  classification,
+					Count:           count,
+					Start:           start,
+					End:             start.Add(patchWindowDuration),
+					Maintainers:     blueprintMaintainers(file.Data),
+					source:          fmt.Sprintf("%s#%d", file.FileName, i),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(windows, func(i, j int) bool {
+		if windows[i].Dc != windows[j].Dc {
+			return windows[i].Dc < windows[j].Dc
+		}
+		if windows[i].Env != windows[j].Env {
+			return windows[i].Env < windows[j].Env
+		}
+		return windows[i].Start.Before(windows[j].Start)
+	})
+
+	return windows
+}
+
+// markOverlappingWindows flags windows of different update blueprints that patch the same blueprint at the same time in a dc-env,
+// the windows are sorted by dc-env and start as returned by collectPatchWindows
+func markOverlappingWindows(windows []patchWindow) []windowOverlap {
+	var overlaps []windowOverlap
+
+	for i := range windows {
+		for j := i + 1; j < len(windows); j++ {
+			first, second := &windows[i], &windows[j]
+			// The next windows are in another dc-env or start after the end of the first one
+			if first.Dc != second.Dc || first.Env != second.Env || !second.Start.Before(first.End) {
+				break
+			}
+			if first.source == second.source {
+				continue
+			}
+
+			var shared []string
+			for _, a := range first.Blueprints {
+				for _, b := range second.Blueprints {
+					if strings.EqualFold(a, b) {
+						shared = append(shared, a)
+					}
+				}
+			}
+			if len(shared) == 0 {
+				continue
+			}
+
+			first.Overlaps = append(first.Overlaps, second.UpdateBlueprint)
+			second.Overlaps = append(second.Overlaps, first.UpdateBlueprint)
+			overlaps = append(overlaps, windowOverlap{First: first, Second: second, Blueprints: shared})
+		}
+	}
+
+	return overlaps
+}
+
+// scheduleHorizon returns the period covered by the schedule checks, starting at the current hour of the scheduleTimeZone the cron schedules run in
+func scheduleHorizon(weeks int, config *Config) (time.Time, time.Time) {
+	location := config.scheduleLocation
+	if location == nil {
+		location = time.UTC
+	}
+	now := time.Now().In(location)
+	from := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, location)
+	return from, from.AddDate(0, 0, 7*weeks)
+}
+
+func checkUpdateBlueprintsSchedule(updateBlueprintsFileNames []string, config *Config, weeks int) []Finding {
+	updateBlueprints := loadYAMLFiles(updateBlueprintsFileNames)
+
+	// Store cleanup guidance
+	var findings []Finding
+
+	// Validate the cron expressions of the target update blueprints in the dc-env
+	for _, file := range updateBlueprints {
+		if !isTargetBlueprint(file.Data, config) {
+			continue
+		}
+
+		for _, envMap := range environmentEntries(file.Data) {
+			if envMap["environment"] != config.Application.Env || envMap["datacenter"] != config.Application.Dc {
+				continue
+			}
+
+			if _, err := environmentSchedule(envMap); err != nil {
+				slog.Info("Update blueprint has an invalid schedule", "update_blueprint", blueprintPBN(file.Data), "dc", config.Application.Dc, "env", config.Application.Env, "error", err)
+				findings = append(findings, newFinding("update-blueprints-schedule", severityError, file.Data, file.FileName, fmt.Sprintf("Update blueprint %s-%s-%s has an invalid schedule: %v. Check file %s", blueprintPBN(file.Data), config.Application.Dc, config.Application.Env, err, file.FileName)).inEnvironment(config.Application.Dc, config.Application.Env).atEnvironment("scheduling"))
+			} else {
+				slog.Debug("Update blueprint has a valid schedule", "update_blueprint", blueprintPBN(file.Data), "dc", config.Application.Dc, "env", config.Application.Env)
+			}
+		}
+	}
+
+	// Look for update blueprints patching the same blueprint at the same time, the other update blueprint can belong to any team
+	from, to := scheduleHorizon(weeks, config)
+	var windows []patchWindow
+	for _, window := range collectPatchWindows(updateBlueprints, from, to) {
+		if window.Dc == config.Application.Dc && window.Env == config.Application.Env {
+			windows = append(windows, window)
+		}
+	}
+	targets := make(map[string]bool)
+	for _, file := range targetFiles(updateBlueprints, config) {
+		targets[file.FileName] = true
+	}
+
+	reported := make(map[string]int)
+	var order []string
+	firstOverlap := make(map[string]windowOverlap)
+	for _, overlap := range markOverlappingWindows(windows) {
+		// Only the overlaps involving a target update blueprint are reported, on the target side
+		if !targets[overlap.First.FileName] {
+			if !targets[overlap.Second.FileName] {
+				continue
+			}
+			overlap.First, overlap.Second = overlap.Second, overlap.First
+		}
+		message := fmt.Sprintf("Update blueprints %s (%s) and %s (%s) patch %s at the same time", overlap.First.UpdateBlueprint, overlap.First.FileName, overlap.Second.UpdateBlueprint, overlap.Second.FileName, strings.Join(overlap.Blueprints, ", "))
+		if _, ok := reported[message]; !ok {
+			order = append(order, message)
+			firstOverlap[message] = overlap
+		}
+		reported[message]++
+	}
+	for _, message := range order {
+		window := firstOverlap[message].First
+		slog.Info(message, "occurrences", reported[message], "weeks", weeks, "next_window", window.Start.Format(time.RFC3339))
+		start := window.Start
+		findings = append(findings, Finding{
+			Check:       "update-blueprints-schedule",
+			Severity:    severityWarning,
+			Blueprint:   window.UpdateBlueprint,
+			Dc:          window.Dc,
+			Env:         window.Env,
+			FileName:    window.FileName,
+			Message:     message,
+			Maintainers: window.Maintainers,
+			NextWindow:  &start,
+		}.atEnvironment("scheduling"))
+	}
+
+	return findings
+}
+
+// exportMaintenanceCalendar writes the patch windows of every dc-env for the next weeks to an .ics or .csv file
+func exportMaintenanceCalendar(updateBlueprintsFileNames []string, config *Config, calendarFile string, weeks int) error {
+	var write func(io.Writer, []patchWindow) error
+	switch strings.ToLower(filepath.Ext(calendarFile)) {
+	case ".ics":
+		write = writeICSCalendar
+	case ".csv":
+		write = writeCSVCalendar
+	default:
+		return fmt.Errorf("unsupported calendar format %q, use .ics or .csv", filepath.Ext(calendarFile))
+	}
+
+	from, to := scheduleHorizon(weeks, config)
+	// Overlaps are marked against the update blueprints of every team, only the windows of the target ones are exported
+	updateBlueprints := loadYAMLFiles(updateBlueprintsFileNames)
+	targets := make(map[string]bool)
+	for _, file := range targetFiles(updateBlueprints, config) {
+		targets[file.FileName] = true
+	}
+	allWindows := collectPatchWindows(updateBlueprints, from, to)
+	markOverlappingWindows(allWindows)
+	var windows []patchWindow
+	for _, window := range allWindows {
+		if targets[window.FileName] {
+			windows = append(windows, window)
+		}
+	}
+
+	file, err := os.Create(calendarFile)
+	if err != nil {
+		return fmt.Errorf("error creating calendar file: %v", err)
+	}
+	defer file.Close()
+
+	if err := write(file, windows); err != nil {
+		return fmt.Errorf("error writing calendar file: %v", err)
+	}
+
+	return nil
+}
+
+// writeCSVCalendar writes one row per patch window
+func writeCSVCalendar(w io.Writer, windows []patchWindow) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"datacenter", "environment", "update_blueprint", "infrastructure_blueprints", "start", "end", "classification", "count", "overlaps", "file"}); err != nil {
+		return err
+	}
+
+	for _, window := range windows {
+		record := []string{
+			window.Dc,
+			window.Env,
+			window.UpdateBlueprint,
+			strings.Join(window.Blueprints, ";"),
+			window.Start.Format(time.RFC3339),
+			window.End.Format(time.RFC3339),
+			window.Classification,
+			strconv.Itoa(window.Count),
+			strings.Join(window.Overlaps, ";"),
+			window.FileName,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeICSCalendar writes one iCalendar event per patch window, overlapping windows are prefixed in the summary
+func writeICSCalendar(w io.Writer, windows []patchWindow) error {
+	const icsTime = "20060102T150405Z"
+	stamp := time.Now().UTC().Format(icsTime)
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//bpcleaner//maintenance calendar//EN",
+		"CALSCALE:GREGORIAN",
+	}
+
+	for _, window := range windows {
+		summary := fmt.Sprintf("[%s-%s] %s patching %s", window.Dc, window.Env, window.UpdateBlueprint, strings.Join(window.Blueprints, ", "))
+		description := fmt.Sprintf("Classification: %s\nCount: %d\nFile: %s", window.Classification, window.Count, window.FileName)
+		if len(window.Overlaps) > 0 {
+			summary = "OVERLAP " + summary
+			description += fmt.Sprintf("\nOverlaps with: %s", strings.Join(window.Overlaps, ", "))
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%s-%s-%s-%s@bpcleaner", window.UpdateBlueprint, window.Dc, window.Env, window.Start.Format(icsTime)),
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+window.Start.UTC().Format(icsTime),
+			"DTEND:"+window.End.UTC().Format(icsTime),
+			"SUMMARY:"+escapeICSText(summary),
+			"DESCRIPTION:"+escapeICSText(description),
+			"CATEGORIES:"+escapeICSText(fmt.Sprintf("%s-%s", window.Dc, window.Env)),
+			"END:VEVENT",
+		)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldICSLine(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// escapeICSText escapes the characters that have a meaning in iCalendar text values
+func escapeICSText(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+// foldICSLine splits lines longer than 75 octets as required by RFC 5545
+func foldICSLine(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var folded strings.Builder
+	cut := limit
+	for len(line) > cut {
+		// Don't split a multi-byte character
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		folded.WriteString(line[:cut])
+		folded.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		cut = limit - 1
+	}
+	folded.WriteString(line)
+
+	return folded.String()
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// selector is a compiled scope selector expression, e.g.
+// maintainers contains infrastructure-caching-admins and tech_type == haproxy and platform in [infrastructure]
+type selector interface {
+	matches(yamlData map[string]interface{}) bool
+}
+
+type selectorAnd struct{ left, right selector }
+type selectorOr struct{ left, right selector }
+type selectorNot struct{ operand selector }
+
+// selectorComparison compares a blueprint field with one or more values
+type selectorComparison struct {
+	field    string
+	operator string
+	values   []string
+}
+
+func (s selectorAnd) matches(yamlData map[string]interface{}) bool {
+	return s.left.matches(yamlData) && s.right.matches(yamlData)
+}
+
+func (s selectorOr) matches(yamlData map[string]interface{}) bool {
+	return s.left.matches(yamlData) || s.right.matches(yamlData)
+}
+
+func (s selectorNot) matches(yamlData map[string]interface{}) bool {
+	return !s.operand.matches(yamlData)
+}
+
+// selectorFieldValues returns the values of a field as strings, pbn is the platform-boundary-name and dots go into nested maps
+func selectorFieldValues(yamlData map[string]interface{}, field string) ([]string, bool) {
+	if field == "pbn" {
+		return []string{blueprintPBN(yamlData)}, true
+	}
+
+	keys := strings.Split(field, ".")
+	value, ok := yamlData[keys[0]]
+	for _, key := range keys[1:] {
+		if !ok {
+			break
+		}
+		nested, isMap := value.(map[interface{}]interface{})
+		if !isMap {
+			return nil, false
+		}
+		value, ok = nested[key]
+	}
+	if !ok || value == nil {
+		return nil, false
+	}
+
+	if list, isList := value.([]interface{}); isList {
+		var values []string
+		for _, item := range list {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, true
+	}
+
+	return []string{fmt.Sprint(value)}, true
+}
+
+func (s selectorComparison) matches(yamlData map[string]interface{}) bool {
+	fieldValues, ok := selectorFieldValues(yamlData, s.field)
+
+	switch s.operator {
+	case "exists":
+		return ok
+	case "==":
+		return ok && len(fieldValues) == 1 && fieldValues[0] == s.values[0]
+	case "!=":
+		return !ok || len(fieldValues) != 1 || fieldValues[0] != s.values[0]
+	case "contains":
+		for _, value := range fieldValues {
+			if value == s.values[0] {
+				return true
+			}
+		}
+	case "in":
+		for _, value := range fieldValues {
+			for _, candidate := range s.values {
+				if value == candidate {
+					return true
+				}
+			}
+		}
+	case "matches":
+		for _, value := range fieldValues {
+			if matched, _ := path.Match(s.values[0], value); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// selectorParser is a recursive descent parser for selector expressions
+type selectorParser struct {
+	tokens   []string
+	position int
+}
+
+// selectorWordCharacters are the characters of field names and unquoted values besides letters and digits
+const selectorWordCharacters = "_-./*?:@"
+
+// isSelectorPunctuation checks if a token is an operator or punctuation rather than a field name or value
+func isSelectorPunctuation(token string) bool {
+	switch token {
+	case "==", "!=", "!", "(", ")", "[", "]", ",":
+		return true
+	}
+	return false
+}
+
+// tokenizeSelector splits a selector expression into words, quoted strings, operators and punctuation
+func tokenizeSelector(expression string) ([]string, error) {
+	var tokens []string
+
+	for i := 0; i < len(expression); {
+		c, size := utf8.DecodeRuneInString(expression[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case strings.HasPrefix(expression[i:], "==") || strings.HasPrefix(expression[i:], "!="):
+			tokens = append(tokens, expression[i:i+2])
+			i += 2
+		case strings.ContainsRune("()[],!", c):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(expression[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			// Keep the quote so quoted keywords are values
+			tokens = append(tokens, expression[i:i+end+2])
+			i += end + 2
+		case isSelectorWordCharacter(c):
+			start := i
+			for i < len(expression) {
+				c, size := utf8.DecodeRuneInString(expression[i:])
+				if !isSelectorWordCharacter(c) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, expression[start:i])
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d, quote values with other characters", c, i)
+		}
+	}
+
+	return tokens, nil
+}
+
+// isSelectorWordCharacter checks if a character can be part of a field name or unquoted value
+func isSelectorWordCharacter(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune(selectorWordCharacters, c)
+}
+
+// parseSelector compiles a selector expression, an empty expression returns nil
+func parseSelector(expression string) (selector, error) {
+	tokens, err := tokenizeSelector(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	parser := &selectorParser{tokens: tokens}
+	result, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q", parser.tokens[parser.position])
+	}
+
+	return result, nil
+}
+
+func (p *selectorParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *selectorParser) next() (string, error) {
+	if p.position >= len(p.tokens) {
+		return "", fmt.Errorf("unexpected end of selector")
+	}
+	token := p.tokens[p.position]
+	p.position++
+	return token, nil
+}
+
+func (p *selectorParser) parseOr() (selector, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = selectorOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseAnd() (selector, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.position++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = selectorAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *selectorParser) parseUnary() (selector, error) {
+	switch {
+	case strings.EqualFold(p.peek(), "not") || p.peek() == "!":
+		p.position++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return selectorNot{operand}, nil
+	case p.peek() == "(":
+		p.position++
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, err := p.next(); err != nil || token != ")" {
+			return nil, fmt.Errorf("expected )")
+		}
+		return result, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *selectorParser) parseComparison() (selector, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if isSelectorPunctuation(field) || strings.ContainsAny(field, `"'`) {
+		return nil, fmt.Errorf("expected a field name but found %q", field)
+	}
+
+	operator := strings.ToLower(p.peek())
+	switch operator {
+	case "==", "!=", "contains", "matches":
+		p.position++
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if operator == "matches" {
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %v", value, err)
+			}
+		}
+		return selectorComparison{field: field, operator: operator, values: []string{value}}, nil
+
+	case "in":
+		p.position++
+		if token, err := p.next(); err != nil || token != "[" {
+			return nil, fmt.Errorf("expected [ after in")
+		}
+		// Values are separated by commas
+		var values []string
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			token, err := p.next()
+			if err != nil {
+				return nil, fmt.Errorf("expected ] after the values of in")
+			}
+			if token == "]" {
+				break
+			}
+			if token != "," {
+				return nil, fmt.Errorf("expected , or ] but found %q", token)
+			}
+		}
+		return selectorComparison{field: field, operator: operator, values: values}, nil
+	}
+
+	// A field alone checks that it is set
+	return selectorComparison{field: field, operator: "exists"}, nil
+}
+
+func (p *selectorParser) parseValue() (string, error) {
+	value, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if isSelectorPunctuation(value) {
+		return "", fmt.Errorf("expected a value but found %q", value)
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		value = value[1 : len(value)-1]
+	}
+	return value, nil
+}
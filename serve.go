@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// serverState holds the results of the last run of the checks, shared by the HTTP handlers
+type serverState struct {
+	mu sync.RWMutex
+	// run is nil until the first successful run
+	run *findingsRun
+	// blueprints maps the lowercased PBN of the target blueprints and update blueprints to their file
+	blueprints  map[string]yamlFile
+	inventory   []inventoryRow
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	// lastDuration is the duration of the last successful run
+	lastDuration time.Duration
+	metrics      *serverMetrics
+}
+
+// blueprintStatus is the JSON response of /blueprints/{pbn}
+type blueprintStatus struct {
+	Blueprint   string         `json:"blueprint"`
+	File        string         `json:"file"`
+	Maintainers []string       `json:"maintainers,omitempty"`
+	Findings    []Finding      `json:"findings"`
+	Inventory   []inventoryRow `json:"inventory"`
+}
+
+// refresh runs the checks and loads the blueprints and inventory, keeping the previous results when the checks fail
+func (s *serverState) refresh(scope string, config *Config, weeks int) {
+	started := time.Now()
+	// A panicking check fails the run instead of stopping the refreshes
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Checks panicked", "panic", r)
+			s.mu.Lock()
+			s.lastRun, s.lastError = started, fmt.Sprintf("checks panicked: %v", r)
+			s.mu.Unlock()
+		}
+	}()
+
+	// The inventory reuses the files and Azure VM lookups of the checks
+	files := &repositoryFiles{config: config}
+	results, err := runChecks(files, scope, config, weeks)
+	if err != nil {
+		slog.Error("Error running checks", "error", err)
+		s.mu.Lock()
+		s.lastRun, s.lastError = started, err.Error()
+		s.mu.Unlock()
+		return
+	}
+	run := newFindingsRun(results, config, started)
+
+	blueprintsFileNames, err := files.allBlueprints()
+	if err != nil {
+		slog.Error("Error getting file names", "error", err)
+	}
+	updateBlueprintsFileNames, err := files.allUpdateBlueprints()
+	if err != nil {
+		slog.Error("Error getting file names", "error", err)
+	}
+	targetBlueprints := targetFiles(loadYAMLFiles(blueprintsFileNames), config)
+	blueprints := make(map[string]yamlFile)
+	for _, file := range append(targetFiles(loadYAMLFiles(updateBlueprintsFileNames), config), targetBlueprints...) {
+		blueprints[strings.ToLower(blueprintPBN(file.Data))] = file
+	}
+	inventory := buildInventory(targetBlueprints, files.azureVMs(), config)
+
+	s.mu.Lock()
+	s.run, s.blueprints, s.inventory = &run, blueprints, inventory
+	s.lastRun, s.lastSuccess, s.lastError = started, time.Now(), ""
+	s.lastDuration = s.lastSuccess.Sub(started)
+	s.mu.Unlock()
+
+	slog.Info("Checks completed", "findings", len(run.Findings), "blueprints", len(blueprints), "duration", s.lastDuration.Round(time.Millisecond).String())
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(body); err != nil {
+		slog.Error("Error writing response", "error", err)
+	}
+}
+
+// writeJSONError writes a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// getOnly rejects the requests other than GET and HEAD
+func getOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleHealth reports whether the checks ran successfully, 503 until the first successful run
+func (s *serverState) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	health := map[string]interface{}{"status": "ok"}
+	status := http.StatusOK
+	if s.run == nil {
+		health["status"] = "starting"
+		status = http.StatusServiceUnavailable
+	} else {
+		health["last_success"] = s.lastSuccess
+	}
+	if !s.lastRun.IsZero() {
+		health["last_run"] = s.lastRun
+	}
+	if s.lastError != "" {
+		health["last_error"] = s.lastError
+	}
+	writeJSON(w, status, health)
+}
+
+// handleFindings returns the findings of the last run, only the ones of a blueprint with ?pbn=
+func (s *serverState) handleFindings(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.run == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "checks have not completed yet")
+		return
+	}
+
+	pbn := r.URL.Query().Get("pbn")
+	if pbn == "" {
+		writeJSON(w, http.StatusOK, s.run)
+		return
+	}
+	run := *s.run
+	run.Findings = blueprintFindings(s.run.Findings, pbn)
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleBlueprint returns the findings and inventory of a blueprint or update blueprint, e.g. /blueprints/infrastructure-haproxy-waf-integrations
+func (s *serverState) handleBlueprint(w http.ResponseWriter, r *http.Request) {
+	pbn := strings.Trim(strings.TrimPrefix(r.URL.Path, "/blueprints/"), "/")
+	if pbn == "" || strings.Contains(pbn, "/") {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.run == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "checks have not completed yet")
+		return
+	}
+
+	file, ok := s.blueprints[strings.ToLower(pbn)]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("blueprint %s not found", pbn))
+		return
+	}
+	status := blueprintStatus{
+		Blueprint:   blueprintPBN(file.Data),
+		File:        file.FileName,
+		Maintainers: blueprintMaintainers(file.Data),
+		Findings:    blueprintFindings(s.run.Findings, pbn),
+		Inventory:   []inventoryRow{},
+	}
+	for _, row := range s.inventory {
+		if strings.EqualFold(row.Blueprint, pbn) {
+			status.Inventory = append(status.Inventory, row)
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// blueprintFindings returns the findings of a blueprint, never nil so they are written as a JSON list
+func blueprintFindings(findings []Finding, pbn string) []Finding {
+	filtered := []Finding{}
+	for _, finding := range findings {
+		if strings.EqualFold(finding.Blueprint, pbn) {
+			filtered = append(filtered, finding)
+		}
+	}
+	return filtered
+}
+
+// newServerMux routes the HTTP API
+func newServerMux(state *serverState) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", getOnly(state.handleHealth))
+	mux.HandleFunc("/findings", getOnly(state.handleFindings))
+	mux.HandleFunc("/blueprints/", getOnly(state.handleBlueprint))
+	mux.HandleFunc("/metrics", getOnly(state.handleMetrics))
+	return mux
+}
+
+// runServeCommand runs the checks on a schedule and serves their results, e.g. bpcleaner serve -config <config file> -listen :8080
+func runServeCommand(args []string) {
+	// Define command-line flags
+	var configFile string
+	var scope string
+	var weeks int
+	var listen string
+	var interval time.Duration
+	var output outputOptions
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "Path to the configuration file")
+	flags.StringVar(&scope, "scope", "all", "Checks to run, same values as the main -scope flag")
+	flags.IntVar(&weeks, "weeks", 4, "Number of weeks covered by the schedule checks")
+	flags.StringVar(&listen, "listen", ":8080", "Address of the HTTP API")
+	flags.DurationVar(&interval, "interval", 15*time.Minute, "Time between two runs of the checks")
+	output.register(flags)
+	flags.Parse(args)
+
+	if err := output.setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	if interval <= 0 {
+		slog.Error("-interval must be positive")
+		return
+	}
+
+	// Read configuration from the file
+	config, err := readConfig(configFile)
+	if err != nil {
+		slog.Error("Error reading configuration", "error", err)
+		return
+	}
+
+	// Compile the configured blueprints selector
+	if err := applySelector(config, ""); err != nil {
+		slog.Error("Error parsing selector", "error", err)
+		return
+	}
+
+	// Login to Azure CLI once for every run
+	if err := azureLoginIfNeeded(config.Azure.Cloud); err != nil {
+		slog.Error("Error logging in to Azure CLI", "error", err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	state := &serverState{metrics: newServerMetrics()}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			state.refresh(scope, config, weeks)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	server := &http.Server{Addr: listen, Handler: newServerMux(state), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving HTTP API", "listen", listen, "interval", interval.String())
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Error serving HTTP API", "error", err)
+	}
+}
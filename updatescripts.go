@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// saltStatePairs maps pre_scripts salt states to the post_scripts salt state that must undo them
+var saltStatePairs = map[string]string{
+	"off_rotation": "on_rotation",
+}
+
+// slackChannelRegex matches a well-formed Slack channel name
+var slackChannelRegex = regexp.MustCompile(`^#[a-z0-9][a-z0-9._-]{0,79}$`)
+
+// scriptSaltStates returns the salt states called by a pre_scripts or post_scripts block
+func scriptSaltStates(scripts interface{}) []string {
+	var states []string
+
+	switch v := scripts.(type) {
+	case map[interface{}]interface{}:
+		switch call := v["salt-call"].(type) {
+		case string:
+			states = append(states, call)
+		case []interface{}:
+			for _, item := range call {
+				if state, ok := item.(string); ok {
+					states = append(states, state)
+				}
+			}
+		}
+	case []interface{}:
+		// A list of script blocks
+		for _, item := range v {
+			states = append(states, scriptSaltStates(item)...)
+		}
+	}
+
+	return states
+}
+
+// saltStateExists checks if a salt state or execution module function exists in the salt states directory
+func saltStateExists(saltStatesDirectoryPath string, state string) bool {
+	fields := strings.Fields(state)
+	if len(fields) == 0 {
+		return false
+	}
+	state = fields[0]
+
+	statePath := filepath.Join(saltStatesDirectoryPath, filepath.FromSlash(strings.ReplaceAll(state, ".", "/")))
+	for _, candidate := range []string{statePath + ".sls", filepath.Join(statePath, "init.sls")} {
+		if _, err := os.Stat(candidate); err == nil {
+			return true
+		}
+	}
+
+	// module.function calls a custom execution module
+	if module, function, found := strings.Cut(state, "."); found {
+		content, err := os.ReadFile(filepath.Join(saltStatesDirectoryPath, "_modules", module+".py"))
+		if err == nil && regexp.MustCompile(`(?m)^def\s+`+regexp.QuoteMeta(function)+`\s*\(`).Match(content) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func checkUpdateBlueprintsScripts(updateBlueprintsFileNames []string, config *Config) []Finding {
+	// Store cleanup guidance
+	var findings []Finding
+
+	for _, file := range targetFiles(loadYAMLFiles(updateBlueprintsFileNames), config) {
+		pbn := blueprintPBN(file.Data)
+		preStates := scriptSaltStates(file.Data["pre_scripts"])
+		postStates := scriptSaltStates(file.Data["post_scripts"])
+
+		// Every state that takes the VM out must be undone after patching
+		for _, preState := range preStates {
+			module, function, _ := strings.Cut(preState, ".")
+			pairFunction, ok := saltStatePairs[function]
+			if !ok {
+				continue
+			}
+
+			pairState := fmt.Sprintf("%s.%s", module, pairFunction)
+			found := false
+			for _, postState := range postStates {
+				if postState == pairState {
+					found = true
+					break
+				}
+			}
+			if found {
+				slog.Debug("Update blueprint calls the paired salt states", "update_blueprint", pbn, "pre_script", preState, "post_script", pairState)
+			} else {
+				slog.Info("Update blueprint calls a salt state without its pair", "update_blueprint", pbn, "pre_script", preState, "missing_post_script", pairState)
+				findings = append(findings, newFinding("update-blueprints-scripts", severityError, file.Data, file.FileName, fmt.Sprintf("Update blueprint %s calls %s in pre_scripts without %s in post_scripts. Check file %s", pbn, preState, pairState, file.FileName)).at("pre_scripts"))
+			}
+		}
+
+		// Referenced salt states must exist
+		if config.Application.SaltStatesDirectoryPath != "" {
+			for i, state := range append(preStates, postStates...) {
+				scripts := "pre_scripts"
+				if i >= len(preStates) {
+					scripts = "post_scripts"
+				}
+				if !saltStateExists(config.Application.SaltStatesDirectoryPath, state) {
+					slog.Info("Salt state not found", "state", state, "update_blueprint", pbn)
+					findings = append(findings, newFinding("update-blueprints-scripts", severityError, file.Data, file.FileName, fmt.Sprintf("Salt state %s of update blueprint %s not found in %s. Check file %s", state, pbn, config.Application.SaltStatesDirectoryPath, file.FileName)).at(scripts))
+				}
+			}
+		}
+
+		// Slack channels must be well-formed
+		if alerting, ok := file.Data["alerting"].(map[interface{}]interface{}); ok {
+			if slack, ok := alerting["slack"].(map[interface{}]interface{}); ok {
+				var levels []string
+				for level := range slack {
+					levels = append(levels, fmt.Sprint(level))
+				}
+				sort.Strings(levels)
+
+				for _, level := range levels {
+					channelList, ok := slack[level].([]interface{})
+					if !ok {
+						findings = append(findings, newFinding("update-blueprints-scripts", severityWarning, file.Data, file.FileName, fmt.Sprintf("Slack channels of level %s in update blueprint %s are not a list. Check file %s", level, pbn, file.FileName)).at("alerting", "slack", level))
+						continue
+					}
+					for channelIndex, channel := range channelList {
+						name, ok := channel.(string)
+						if !ok || !slackChannelRegex.MatchString(name) {
+							slog.Info("Slack channel is not well-formed", "channel", channel, "update_blueprint", pbn)
+							findings = append(findings, newFinding("update-blueprints-scripts", severityWarning, file.Data, file.FileName, fmt.Sprintf("Slack channel %v (%s) of update blueprint %s is not well-formed. Check file %s", channel, level, pbn, file.FileName)).at("alerting", "slack", level, channelIndex))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return findings
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// waiverDateLayout is the layout of the waivers expiry dates
+const waiverDateLayout = "2006-01-02"
+
+// waiver suppresses the findings of a check for a blueprint, or a single finding by its fingerprint,
+// optionally limited to a dc, an env and a VM, until it expires
+type waiver struct {
+	Check     string `yaml:"check"`
+	Finding   string `yaml:"finding"`
+	Blueprint string `yaml:"blueprint"`
+	Dc        string `yaml:"dc"`
+	Env       string `yaml:"env"`
+	VM        string `yaml:"vm"`
+	Reason    string `yaml:"reason"`
+	Expires   string `yaml:"expires"`
+
+	// source is where the waiver is defined, fileName only limits inline annotations to the findings of their file
+	source   string
+	fileName string
+	expiry   time.Time
+	// pbn and maintainers are the ones of the file of an inline annotation
+	pbn         string
+	maintainers []string
+	// path is the position of the waiver in the waivers file, line the line of an inline annotation
+	path []interface{}
+	line int
+}
+
+// waiversFile is the format of the waivers file
+type waiversFile struct {
+	Waivers []waiver `yaml:"waivers"`
+}
+
+// waiverAnnotationRegex matches inline annotations, e.g.
+// # bpcleaner:waive check=blueprints vm=rg-vm-1 expires=2026-09-30 reason="Stopped and deallocated until Q3"
+var waiverAnnotationRegex = regexp.MustCompile(`#\s*bpcleaner:waive\s+(.*)$`)
+var waiverAnnotationFieldRegex = regexp.MustCompile(`(\w+)=("[^"]*"|'[^']*'|\S+)`)
+
+// findingFingerprintRegex matches the fingerprints written to the -json findings
+var findingFingerprintRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// readWaiversFile reads the waivers of the waivers file
+func readWaiversFile(waiversPath string) ([]waiver, error) {
+	fileContent, err := ioutil.ReadFile(waiversPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading waivers: %v", err)
+	}
+
+	var file waiversFile
+	if err := yaml.Unmarshal(fileContent, &file); err != nil {
+		return nil, fmt.Errorf("error parsing waivers: %v", err)
+	}
+	for i := range file.Waivers {
+		file.Waivers[i].source = fmt.Sprintf("%s waiver %d", waiversPath, i+1)
+		file.Waivers[i].path = []interface{}{"waivers", i}
+	}
+
+	return file.Waivers, nil
+}
+
+// readWaiverAnnotations reads the bpcleaner:waive comments of a blueprint or update blueprint file
+func readWaiverAnnotations(fileName string) ([]waiver, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var waivers []waiver
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		match := waiverAnnotationRegex.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		w := waiver{source: fmt.Sprintf("%s:%d", fileName, line), fileName: fileName, line: line}
+		for _, field := range waiverAnnotationFieldRegex.FindAllStringSubmatch(match[1], -1) {
+			value := strings.Trim(field[2], `"'`)
+			switch field[1] {
+			case "check":
+				w.Check = value
+			case "finding":
+				w.Finding = value
+			case "dc":
+				w.Dc = value
+			case "env":
+				w.Env = value
+			case "vm":
+				w.VM = value
+			case "reason":
+				w.Reason = value
+			case "expires":
+				w.Expires = value
+			}
+		}
+		waivers = append(waivers, w)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The findings about the annotations are reported for the blueprint of the file
+	if len(waivers) > 0 {
+		for _, file := range loadYAMLFiles([]string{fileName}) {
+			for i := range waivers {
+				waivers[i].pbn = blueprintPBN(file.Data)
+				waivers[i].maintainers = blueprintMaintainers(file.Data)
+			}
+		}
+	}
+
+	return waivers, nil
+}
+
+// validate checks the waiver has a known check, a reason and a valid expiry date
+func (w *waiver) validate() error {
+	if w.Check == "" {
+		return fmt.Errorf("has no check")
+	}
+	known := false
+	for _, c := range checks {
+		known = known || c.Scope == w.Check
+	}
+	if !known {
+		return fmt.Errorf("has unknown check %s", w.Check)
+	}
+	if strings.TrimSpace(w.Reason) == "" {
+		return fmt.Errorf("has no reason")
+	}
+	if w.Expires == "" {
+		return fmt.Errorf("has no expiry date")
+	}
+	expiry, err := time.Parse(waiverDateLayout, w.Expires)
+	if err != nil {
+		return fmt.Errorf("has an invalid expiry date %s, expected YYYY-MM-DD", w.Expires)
+	}
+	w.expiry = expiry
+	if w.Finding != "" && !findingFingerprintRegex.MatchString(w.Finding) {
+		return fmt.Errorf("has an invalid finding fingerprint %s, expected the fingerprint of the -json findings", w.Finding)
+	}
+	if w.fileName == "" && w.Blueprint == "" && w.Finding == "" {
+		return fmt.Errorf("has no blueprint or finding")
+	}
+	if _, err := path.Match(w.Blueprint, ""); err != nil {
+		return fmt.Errorf("has an invalid blueprint glob %s", w.Blueprint)
+	}
+
+	return nil
+}
+
+// expired checks if the waiver expiry date is over, the waiver is valid during its expiry date
+func (w waiver) expired(now time.Time) bool {
+	return !now.Before(w.expiry.AddDate(0, 0, 1))
+}
+
+// suppresses checks if the waiver covers a finding
+func (w waiver) suppresses(finding Finding) bool {
+	if w.Check != finding.Check {
+		return false
+	}
+	if w.fileName != "" && w.fileName != finding.FileName {
+		return false
+	}
+	if w.Finding != "" && w.Finding != findingFingerprint(finding) {
+		return false
+	}
+	if (w.Dc != "" && w.Dc != finding.Dc) || (w.Env != "" && w.Env != finding.Env) {
+		return false
+	}
+	if w.Blueprint != "" {
+		if matched, _ := path.Match(w.Blueprint, finding.Blueprint); !matched {
+			return false
+		}
+	}
+	return w.VM == "" || w.VM == finding.VM
+}
+
+// loadWaivers returns the active waivers of the waivers file and of the annotations in the repository files,
+// along with findings about the invalid ones and the expired ones of the checks in scope
+func loadWaivers(files *repositoryFiles, config *Config, scopes map[string]bool, now time.Time) ([]waiver, []Finding, error) {
+	var waivers []waiver
+
+	if config.Application.WaiversPath != "" {
+		fileWaivers, err := readWaiversFile(config.Application.WaiversPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		waivers = append(waivers, fileWaivers...)
+	}
+
+	// Inline annotations of the configured directories
+	var fileNames []string
+	if config.Application.BlueprintsDirectoryPath != "" {
+		blueprintsFileNames, err := files.blueprints()
+		if err != nil {
+			return nil, nil, err
+		}
+		fileNames = append(fileNames, blueprintsFileNames...)
+	}
+	if config.Application.UpdateBlueprintsDirectoryPath != "" {
+		updateBlueprintsFileNames, err := files.updateBlueprints()
+		if err != nil {
+			return nil, nil, err
+		}
+		fileNames = append(fileNames, updateBlueprintsFileNames...)
+	}
+	for _, fileName := range fileNames {
+		annotations, err := readWaiverAnnotations(fileName)
+		if err != nil {
+			return nil, nil, err
+		}
+		waivers = append(waivers, annotations...)
+	}
+
+	var active []waiver
+	var findings []Finding
+	for _, w := range waivers {
+		finding := Finding{Check: "waivers", Blueprint: w.Blueprint, Dc: w.Dc, Env: w.Env, VM: w.VM, FileName: w.fileName, Maintainers: w.maintainers}
+		if w.pbn != "" {
+			finding.Blueprint = w.pbn
+		}
+		if finding.FileName == "" {
+			finding.FileName = config.Application.WaiversPath
+			finding = finding.at(w.path...)
+		} else {
+			finding.Line, finding.Column = w.line, 1
+		}
+
+		if err := w.validate(); err != nil {
+			slog.Warn("Invalid waiver", "waiver", w.source, "error", err)
+			finding.Severity = severityError
+			finding.Message = fmt.Sprintf("Waiver %s %v, it is ignored", w.source, err)
+			findings = append(findings, finding)
+			continue
+		}
+		if w.expired(now) {
+			if !scopes[w.Check] {
+				continue
+			}
+			slog.Warn("Waiver expired", "waiver", w.source, "expires", w.Expires)
+			finding.Severity = severityWarning
+			finding.Message = fmt.Sprintf("Waiver %s of the %s check expired on %s (%s), renew or remove it", w.source, w.Check, w.Expires, w.Reason)
+			findings = append(findings, finding)
+			continue
+		}
+		active = append(active, w)
+	}
+
+	return active, findings, nil
+}
+
+// applyWaivers splits the findings into the reported ones and the ones suppressed by a waiver
+func applyWaivers(findings []Finding, waivers []waiver) ([]Finding, []Finding) {
+	var reported, suppressed []Finding
+
+	for _, finding := range findings {
+		waived := false
+		for _, w := range waivers {
+			if w.suppresses(finding) {
+				waived = true
+				break
+			}
+		}
+		if waived {
+			suppressed = append(suppressed, finding)
+		} else {
+			reported = append(reported, finding)
+		}
+	}
+
+	return reported, suppressed
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is the time without file events before the changed files are checked, editors write files in several steps
+const watchDebounce = 100 * time.Millisecond
+
+// azureSnapshotEntry is the output of an Azure CLI query
+type azureSnapshotEntry struct {
+	output []byte
+	err    error
+}
+
+// azureSnapshot caches the Azure CLI vm queries while watching, so checking changed files doesn't wait for Azure
+var azureSnapshot = struct {
+	sync.Mutex
+	enabled bool
+	outputs map[string]azureSnapshotEntry
+}{outputs: make(map[string]azureSnapshotEntry)}
+
+// enableAzureSnapshot makes the Azure CLI vm queries answered from the first time they were run
+func enableAzureSnapshot() {
+	azureSnapshot.Lock()
+	defer azureSnapshot.Unlock()
+	azureSnapshot.enabled = true
+}
+
+// azureSnapshotKey returns the key of the cached Azure CLI query, empty when it isn't cached
+func azureSnapshotKey(args []string) string {
+	if len(args) == 0 || args[0] != "vm" {
+		return ""
+	}
+	return strings.Join(args, "\x00")
+}
+
+// azureSnapshotLookup returns the cached output of an Azure CLI query
+func azureSnapshotLookup(args []string) (azureSnapshotEntry, bool) {
+	azureSnapshot.Lock()
+	defer azureSnapshot.Unlock()
+
+	key := azureSnapshotKey(args)
+	if !azureSnapshot.enabled || key == "" {
+		return azureSnapshotEntry{}, false
+	}
+	entry, ok := azureSnapshot.outputs[key]
+	return entry, ok
+}
+
+// azureSnapshotStore caches the output of an Azure CLI query when the snapshot is enabled,
+// only successful queries and not found answers are cached so the failed ones are tried again
+func azureSnapshotStore(args []string, output []byte, err error) {
+	azureSnapshot.Lock()
+	defer azureSnapshot.Unlock()
+
+	if err != nil && !strings.Contains(string(output), "ResourceNotFound") && !strings.Contains(string(output), "ResourceGroupNotFound") {
+		return
+	}
+	if key := azureSnapshotKey(args); azureSnapshot.enabled && key != "" {
+		azureSnapshot.outputs[key] = azureSnapshotEntry{output: output, err: err}
+	}
+}
+
+// crossFileScopes are the checks comparing the patch windows of every update blueprint, checked again on every file when one changes
+var crossFileScopes = map[string]bool{"update-blueprints-schedule": true, "update-blueprints-loadbalancers": true}
+
+// watchState holds the findings of every file, updated with the findings of the changed files
+type watchState struct {
+	scope   string
+	config  *Config
+	weeks   int
+	results []checkResult
+	// blame sets the last change of the rechecked findings
+	blame bool
+	// blueprints maps the canonical path of the blueprints to their PBN, to recheck the update blueprints of a deleted blueprint
+	blueprints map[string]string
+}
+
+// addWatches watches a directory and its subdirectories, except .git
+func addWatches(watcher *fsnotify.Watcher, directoryPath string) error {
+	return filepath.WalkDir(directoryPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// watchedDirectories returns the configured blueprints and update blueprints directories
+func watchedDirectories(config *Config) []string {
+	var directories []string
+	for _, directoryPath := range []string{config.Application.BlueprintsDirectoryPath, config.Application.UpdateBlueprintsDirectoryPath} {
+		if directoryPath != "" {
+			directories = append(directories, directoryPath)
+		}
+	}
+	return directories
+}
+
+// watchFiles checks the blueprints and update blueprints again when they change and writes the updated findings
+func watchFiles(results []checkResult, scope string, config *Config, weeks int, blame bool, writeReport func([]checkResult) error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, directoryPath := range watchedDirectories(config) {
+		if err := addWatches(watcher, directoryPath); err != nil {
+			return err
+		}
+	}
+
+	state := &watchState{scope: scope, config: config, weeks: weeks, results: results, blame: blame, blueprints: make(map[string]string)}
+	blueprintsFileNames, err := getAllYAMLFiles(config.Application.BlueprintsDirectoryPath, config)
+	if err != nil {
+		return err
+	}
+	for _, file := range loadYAMLFiles(blueprintsFileNames) {
+		state.blueprints[canonicalPath(file.FileName)] = blueprintPBN(file.Data)
+	}
+
+	slog.Info("Watching for changes", "directories", watchedDirectories(config))
+
+	changed := make(map[string]bool)
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// New directories are watched too
+			if event.Has(fsnotify.Create) {
+				if err := addWatches(watcher, event.Name); err != nil {
+					slog.Debug("Error watching path", "path", event.Name, "error", err)
+				}
+			}
+			changed[canonicalPath(event.Name)] = true
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Error watching files", "error", err)
+		case <-debounce.C:
+			checked, err := state.recheck(changed)
+			changed = make(map[string]bool)
+			if err != nil {
+				slog.Error(err.Error())
+				continue
+			}
+			if checked {
+				if err := writeReport(state.results); err != nil {
+					slog.Error("Error writing report", "error", err)
+				}
+			}
+		}
+	}
+}
+
+// recheck runs the checks affected by the changed paths on the changed files and the update blueprints referencing them,
+// returning false when no blueprint or update blueprint changed
+func (s *watchState) recheck(changed map[string]bool) (bool, error) {
+	started := time.Now()
+	config := s.config
+
+	blueprintsFileNames, err := getAllYAMLFiles(config.Application.BlueprintsDirectoryPath, config)
+	if err != nil {
+		return false, err
+	}
+	updateBlueprintsFileNames, err := getAllYAMLFiles(config.Application.UpdateBlueprintsDirectoryPath, config)
+	if err != nil {
+		return false, err
+	}
+
+	// Changed files and the PBN of the blueprints before the change, whose update blueprints are checked again
+	rechecked := make(map[string]bool)
+	referenced := make(map[string]bool)
+	var changedBlueprints []string
+	for _, fileName := range blueprintsFileNames {
+		path := canonicalPath(fileName)
+		if changed[path] {
+			changedBlueprints = append(changedBlueprints, fileName)
+			rechecked[path] = true
+			if pbn, ok := s.blueprints[path]; ok {
+				referenced[strings.ToLower(pbn)] = true
+			}
+		}
+	}
+	existingUpdateBlueprints := make(map[string]bool)
+	for _, fileName := range updateBlueprintsFileNames {
+		path := canonicalPath(fileName)
+		existingUpdateBlueprints[path] = true
+		if changed[path] {
+			rechecked[path] = true
+		}
+	}
+	// Deleted files, renamed ones are deleted then created
+	blueprintsDeleted, updateBlueprintsChanged := false, false
+	for path := range changed {
+		if pbn, ok := s.blueprints[path]; ok && !rechecked[path] {
+			slog.Info("Blueprint was deleted", "blueprint", pbn)
+			rechecked[path], referenced[strings.ToLower(pbn)], blueprintsDeleted = true, true, true
+			delete(s.blueprints, path)
+			continue
+		}
+		extension := filepath.Ext(path)
+		if existingUpdateBlueprints[path] || (!rechecked[path] && (extension == ".yaml" || extension == ".yml")) {
+			// The findings of a deleted update blueprint are removed
+			rechecked[path], updateBlueprintsChanged = true, true
+		}
+	}
+	if len(rechecked) == 0 {
+		return false, nil
+	}
+
+	for _, file := range loadYAMLFiles(changedBlueprints) {
+		pbn := blueprintPBN(file.Data)
+		s.blueprints[canonicalPath(file.FileName)] = pbn
+		referenced[strings.ToLower(pbn)] = true
+	}
+	changedUpdateBlueprints := updateBlueprintsInScope(updateBlueprintsFileNames, rechecked, referenced)
+	for _, fileName := range changedUpdateBlueprints {
+		rechecked[canonicalPath(fileName)] = true
+	}
+
+	// Blueprints changes affect the blueprints checks, and the update blueprints checks of the update blueprints referencing them
+	fileScopes := make(map[string]bool)
+	allFilesScopes := make(map[string]bool)
+	for _, c := range checks {
+		if s.scope != c.Scope && s.scope != "all" {
+			continue
+		}
+		switch {
+		case !strings.HasPrefix(c.Scope, "update-blueprints"):
+			fileScopes[c.Scope] = len(changedBlueprints) > 0 || blueprintsDeleted
+		case crossFileScopes[c.Scope]:
+			allFilesScopes[c.Scope] = updateBlueprintsChanged || len(changedUpdateBlueprints) > 0
+		default:
+			fileScopes[c.Scope] = updateBlueprintsChanged || len(changedUpdateBlueprints) > 0
+		}
+	}
+
+	files := &repositoryFiles{config: config, changed: &changedScope{blueprints: changedBlueprints, updateBlueprints: changedUpdateBlueprints}}
+	results, err := runScopes(files, fileScopes, config, s.weeks)
+	if err != nil {
+		return false, err
+	}
+	allFilesResults, err := runScopes(&repositoryFiles{config: config}, allFilesScopes, config, s.weeks)
+	if err != nil {
+		return false, err
+	}
+	results = append(results, allFilesResults...)
+	if s.blame {
+		gitHistory := newGitBlame()
+		for _, result := range results {
+			gitHistory.enrich(result.Findings)
+		}
+	}
+	s.merge(results, fileScopes, allFilesScopes, rechecked)
+
+	slog.Info("Checked changed files", "blueprints", len(changedBlueprints), "update_blueprints", len(changedUpdateBlueprints), "duration", time.Since(started).Round(time.Millisecond).String())
+
+	return true, nil
+}
+
+// waiverFindingKey identifies the same waiver finding reported by several runs, several waivers of a file have the same finding key
+func waiverFindingKey(finding Finding) string {
+	return fmt.Sprintf("%s\x00%d\x00%s", findingKey(finding), finding.Line, finding.Message)
+}
+
+// merge replaces the findings of the rechecked files in the results of the file scopes, and the whole results of the all files scopes
+func (s *watchState) merge(results []checkResult, fileScopes map[string]bool, allFilesScopes map[string]bool, rechecked map[string]bool) {
+	keep := func(findings []Finding) []Finding {
+		var kept []Finding
+		for _, finding := range findings {
+			if !rechecked[canonicalPath(finding.FileName)] {
+				kept = append(kept, finding)
+			}
+		}
+		return kept
+	}
+
+	// Every run reports the invalid and expired waivers of the waivers file, they are only added once
+	byScope := make(map[string]checkResult)
+	var waiverFindings []Finding
+	collected := make(map[string]bool)
+	for _, result := range results {
+		if result.Scope != "waivers" {
+			byScope[result.Scope] = result
+			continue
+		}
+		for _, finding := range result.Findings {
+			if !collected[waiverFindingKey(finding)] {
+				collected[waiverFindingKey(finding)] = true
+				waiverFindings = append(waiverFindings, finding)
+			}
+		}
+	}
+	if len(waiverFindings) > 0 {
+		byScope["waivers"] = checkResult{Scope: "waivers", Title: "Waivers"}
+	}
+
+	var merged []checkResult
+	for _, result := range s.results {
+		updated, ok := byScope[result.Scope]
+		delete(byScope, result.Scope)
+		switch {
+		case result.Scope == "waivers":
+			result.Findings = keep(result.Findings)
+			known := make(map[string]bool)
+			for _, finding := range result.Findings {
+				known[waiverFindingKey(finding)] = true
+			}
+			for _, finding := range waiverFindings {
+				if !known[waiverFindingKey(finding)] {
+					result.Findings = append(result.Findings, finding)
+				}
+			}
+			// Like runScopes, no waivers result without invalid or expired waivers
+			if len(result.Findings) == 0 {
+				continue
+			}
+		case allFilesScopes[result.Scope] && ok:
+			result = updated
+		case fileScopes[result.Scope]:
+			result.Findings = append(keep(result.Findings), updated.Findings...)
+			result.Suppressed = append(keep(result.Suppressed), updated.Suppressed...)
+		}
+		merged = append(merged, result)
+	}
+
+	// Checks without results before, e.g. the first invalid waiver
+	for _, result := range results {
+		if _, ok := byScope[result.Scope]; ok {
+			if result.Scope == "waivers" {
+				result.Findings = waiverFindings
+			}
+			delete(byScope, result.Scope)
+			merged = append(merged, result)
+		}
+	}
+
+	s.results = merged
+}